@@ -0,0 +1,163 @@
+// Package auth issues and checks the tokens staff use to call the services. Tokens
+// are JWTs signed with HMAC-SHA256 under a secret the services share, so any service
+// can check a token without asking the order service that issued it.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Staff roles
+const (
+	RoleServer  = "server"
+	RoleChef    = "chef"
+	RoleManager = "manager"
+	RoleAdmin   = "admin" // Allowed everything
+)
+
+// Roles lists every role
+var Roles = []string{RoleServer, RoleChef, RoleManager, RoleAdmin}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// MinSecretLength is the shortest secret a Signer accepts, in bytes
+const MinSecretLength = 32
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are the contents of a token
+type Claims struct {
+	Subject   string `json:"sub"` // The staff member's ID
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Location  int    `json:"loc"` // The location the staff member works at
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// HasRole reports whether the claims carry one of the roles. Admins have every role.
+func (c *Claims) HasRole(roles ...string) bool {
+	if c.Role == RoleAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor is how the staff member is recorded in order histories
+func (c *Claims) Actor() string {
+	return fmt.Sprintf("%s (%s)", c.Name, c.Role)
+}
+
+// header is the JOSE header of every token; tokens with another header are rejected
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Signer issues and verifies tokens with one secret
+type Signer struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewSigner returns a Signer for the secret, which must be at least MinSecretLength
+// bytes long
+func NewSigner(secret string) (*Signer, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("auth secret must be at least %d bytes long", MinSecretLength)
+	}
+	return &Signer{secret: []byte(secret), now: time.Now}, nil
+}
+
+// Sign issues a token for the claims, valid for ttl from now
+func (s *Signer) Sign(claims Claims, ttl time.Duration) (string, time.Time, error) {
+	now := s.now()
+	expires := now.Add(ttl)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expires.Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + s.signature(signed), expires, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims. Tokens
+// without a location, issued before there were several, are invalid.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !ValidRole(claims.Role) || claims.Location <= 0 {
+		return nil, ErrInvalidToken
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+func (s *Signer) signature(signed string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// BearerToken returns the token from the request's "Authorization: Bearer" header, or
+// "" when there is none
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// ParseOrigins splits a comma-separated list of allowed CORS origins, e.g. the value of
+// ALLOWED_ORIGINS
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers of the requests table devices sign with their secret instead of sending a
+// staff token
+const (
+	DeviceIDHeader        = "X-Device-ID"
+	DeviceTimestampHeader = "X-Device-Timestamp" // Unix seconds
+	DeviceSignatureHeader = "X-Device-Signature"
+)
+
+// SignDeviceRequest returns the signature a device sends with a request: the hex
+// encoded HMAC-SHA256, under the device's secret, of
+//
+//	<timestamp>\n<method>\n<path>\n<body>
+//
+// where timestamp is in Unix seconds and path has no query string.
+func SignDeviceRequest(secret string, timestamp int64, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDeviceRequest reports whether signature is the device's signature of the
+// request. It does not check how old the timestamp is.
+func VerifyDeviceRequest(secret, signature string, timestamp int64, method, path string, body []byte) bool {
+	expected := SignDeviceRequest(secret, timestamp, method, path, body)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
@@ -0,0 +1,244 @@
+// Package events defines the messages the Bistro-92 services exchange over RabbitMQ.
+//
+// Every message is an Envelope whose Data holds one of the typed payloads below. It is
+// published on Exchange with the routing key RoutingKey(location, type), so that
+// consumers can bind to the events of one location or, through AnyLocation, of all of
+// them. Consumers decode with Decode, which also accepts the bare payloads and the
+// routing keys without a location that older producers used.
+package events
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+// Exchange is the topic exchange all services publish their events to. Consumers bind
+// their own queues to it with the routing key patterns they are interested in.
+const Exchange = "bistro.events"
+
+// Version is the envelope version written by New. Version 0 stands for the bare
+// payloads sent before the envelope was introduced.
+const Version = 1
+
+// DefaultLocation is where events published before locations were introduced belong
+const DefaultLocation = 1
+
+// Event types, which follow the location in the routing keys
+const (
+	OrderCreated       = "order.created"
+	OrderStatusChanged = "order.status.changed"
+	OrderAmended       = "order.amended"
+	OrderCancelled     = "order.cancelled"
+	OrderDeleted       = "order.deleted"
+	OrderAssigned      = "order.assigned"
+	MenuUpdated        = "menu.updated"
+	TableUpdated       = "table.updated"
+)
+
+// Envelope wraps every event
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Source     string          `json:"source"`
+	Location   int             `json:"location"` // The restaurant location the event happened at
+	Data       json.RawMessage `json:"data"`
+}
+
+// RoutingKey is the routing key of an event of the given type at a location, e.g.
+// "loc.2.order.created"
+func RoutingKey(location int, eventType string) string {
+	return "loc." + strconv.Itoa(location) + "." + eventType
+}
+
+// AnyLocation turns a binding pattern for event types, such as "order.#", into one that
+// matches them at every location
+func AnyLocation(pattern string) string {
+	return "loc.*." + pattern
+}
+
+// ParseRoutingKey splits a routing key into its location and event type. Keys without
+// a location, published before locations were introduced, are at DefaultLocation.
+func ParseRoutingKey(routingKey string) (location int, eventType string) {
+	if rest, ok := strings.CutPrefix(routingKey, "loc."); ok {
+		if id, eventType, ok := strings.Cut(rest, "."); ok {
+			if location, err := strconv.Atoi(id); err == nil && location > 0 {
+				return location, eventType
+			}
+		}
+	}
+	return DefaultLocation, routingKey
+}
+
+// OrderItem is an item of an Order payload
+type OrderItem struct {
+	ItemID   int
+	Name     string
+	Quantity int
+	Price    money.Money
+	Course   int    `json:",omitempty"`
+	Notes    string `json:",omitempty"`
+}
+
+// Order is the payload of the order.* events. Reason is only set on order.cancelled and
+// order.deleted;
+// AssignedTo is the name of the chef cooking the order.
+type Order struct {
+	ID           int         `json:"id"`
+	Type         string      `json:"type,omitempty"` // Dine-in when empty
+	TableNumber  int         `json:"table_number"`   // 0 for takeaway and delivery
+	CustomerName string      `json:"customer_name,omitempty"`
+	PickupTime   *time.Time  `json:"pickup_time,omitempty"`
+	Items        []OrderItem `json:"items"`
+	Status       string      `json:"status"`
+	AssignedTo   string      `json:"assigned_to,omitempty"`
+	Reason       string      `json:"reason,omitempty"`
+}
+
+// UnmarshalJSON also reads "order_id", which some version 0 producers used for the ID
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type plain Order
+	var v struct {
+		plain
+		OrderID int `json:"order_id"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*o = Order(v.plain)
+	if o.ID == 0 {
+		o.ID = v.OrderID
+	}
+	return nil
+}
+
+// Table is the payload of table.updated
+type Table struct {
+	Number int    `json:"number"`
+	Status string `json:"status"`
+}
+
+// MenuItem is the payload of menu.updated. Stock is nil when it is not tracked.
+type MenuItem struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Stock *int   `json:"stock"`
+}
+
+// New wraps a payload in an envelope with a fresh ID
+func New(eventType, source string, location int, data interface{}) (Envelope, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:         id,
+		Type:       eventType,
+		Version:    Version,
+		OccurredAt: time.Now().UTC(),
+		Source:     source,
+		Location:   location,
+		Data:       raw,
+	}, nil
+}
+
+// Decode reads a message body. A body without an envelope is taken as a version 0
+// payload of the routing key's type; its ID is derived from the body so that
+// redelivered copies can still be recognised, and its time from its "timestamp".
+// Envelopes of newer versions are decoded as far as this version understands them.
+// Events without a location are placed at the routing key's.
+func Decode(routingKey string, body []byte) (Envelope, error) {
+	location, eventType := ParseRoutingKey(routingKey)
+
+	var probe struct {
+		Version int             `json:"version"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return Envelope{}, err
+	}
+	if probe.Version > 0 && probe.Data != nil {
+		var e Envelope
+		if err := json.Unmarshal(body, &e); err != nil {
+			return Envelope{}, err
+		}
+		if e.Type == "" {
+			e.Type = eventType
+		}
+		if e.Location == 0 {
+			e.Location = location
+		}
+		return e, nil
+	}
+
+	var legacy struct {
+		Timestamp string `json:"timestamp"`
+	}
+	json.Unmarshal(body, &legacy)
+	occurredAt, err := time.Parse(time.RFC3339, legacy.Timestamp)
+	if err != nil {
+		occurredAt = time.Now().UTC()
+	}
+
+	sum := sha256.Sum256(body)
+	return Envelope{
+		ID:         hex.EncodeToString(sum[:16]),
+		Type:       eventType,
+		Version:    0,
+		OccurredAt: occurredAt,
+		Location:   location,
+		Data:       body,
+	}, nil
+}
+
+// Order decodes the payload of an order.* event
+func (e Envelope) Order() (Order, error) {
+	var o Order
+	err := e.decode(&o)
+	return o, err
+}
+
+// Table decodes the payload of a table.updated event
+func (e Envelope) Table() (Table, error) {
+	var t Table
+	err := e.decode(&t)
+	return t, err
+}
+
+// MenuItem decodes the payload of a menu.updated event
+func (e Envelope) MenuItem() (MenuItem, error) {
+	var m MenuItem
+	err := e.decode(&m)
+	return m, err
+}
+
+func (e Envelope) decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("decoding %s event v%d: %w", e.Type, e.Version, err)
+	}
+	return nil
+}
+
+// newID returns a random version 4 UUID
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	occurred := time.Date(2024, 5, 17, 19, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		routingKey string
+		body       string
+		want       Envelope // Data is left out of the comparison
+		order      Order    // Compared when ID is set
+	}{
+		{
+			name:       "current envelope",
+			routingKey: "loc.2.order.created",
+			body:       `{"id": "e1", "type": "order.created", "version": 1, "occurred_at": "2024-05-17T19:30:00Z", "source": "order-service", "location": 2, "data": {"id": 7, "table_number": 3, "items": [], "status": "Pending"}}`,
+			want:       Envelope{ID: "e1", Type: OrderCreated, Version: 1, OccurredAt: occurred, Source: "order-service", Location: 2},
+			order:      Order{ID: 7, TableNumber: 3, Items: []OrderItem{}, Status: "Pending"},
+		},
+		{
+			name:       "envelope without type or location",
+			routingKey: "loc.4.table.updated",
+			body:       `{"id": "e2", "version": 1, "occurred_at": "2024-05-17T19:30:00Z", "data": {"number": 5, "status": "Occupied"}}`,
+			want:       Envelope{ID: "e2", Type: TableUpdated, Version: 1, OccurredAt: occurred, Location: 4},
+		},
+		{
+			name:       "newer envelope",
+			routingKey: "loc.1.order.deleted",
+			body:       `{"id": "e3", "type": "order.deleted", "version": 3, "occurred_at": "2024-05-17T19:30:00Z", "location": 1, "trace": "abc", "data": {"id": 9, "items": [], "status": "Pending", "reason": "Test"}}`,
+			want:       Envelope{ID: "e3", Type: OrderDeleted, Version: 3, OccurredAt: occurred, Location: 1},
+			order:      Order{ID: 9, Items: []OrderItem{}, Status: "Pending", Reason: "Test"},
+		},
+		{
+			name:       "legacy payload on a legacy key",
+			routingKey: "order.created",
+			body:       `{"order_id": 12, "table_number": 6, "items": [], "status": "Pending", "timestamp": "2024-05-17T19:30:00Z"}`,
+			want:       Envelope{Type: OrderCreated, Version: 0, OccurredAt: occurred, Location: DefaultLocation},
+			order:      Order{ID: 12, TableNumber: 6, Items: []OrderItem{}, Status: "Pending"},
+		},
+		{
+			name:       "legacy payload on a current key",
+			routingKey: "loc.3.order.status.changed",
+			body:       `{"id": 12, "status": "Ready", "timestamp": "2024-05-17T19:30:00Z"}`,
+			want:       Envelope{Type: OrderStatusChanged, Version: 0, OccurredAt: occurred, Location: 3},
+			order:      Order{ID: 12, Status: "Ready"},
+		},
+		{
+			name:       "legacy payload with a version but no data",
+			routingKey: "menu.updated",
+			body:       `{"id": 4, "name": "Soup", "version": 2, "timestamp": "2024-05-17T19:30:00Z"}`,
+			want:       Envelope{Type: MenuUpdated, Version: 0, OccurredAt: occurred, Location: DefaultLocation},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.routingKey, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if tt.want.Version == 0 {
+				// Legacy events are identified by their body
+				again, _ := Decode(tt.routingKey, []byte(tt.body))
+				if got.ID == "" || got.ID != again.ID {
+					t.Errorf("IDs %q and %q for the same body, want one stable ID", got.ID, again.ID)
+				}
+				tt.want.ID = got.ID
+			}
+			data := got.Data
+			got.Data = nil
+			if got.ID != tt.want.ID || got.Type != tt.want.Type || got.Version != tt.want.Version ||
+				!got.OccurredAt.Equal(tt.want.OccurredAt) || got.Source != tt.want.Source || got.Location != tt.want.Location {
+				t.Errorf("Decode = %+v, want %+v", got, tt.want)
+			}
+			if len(data) == 0 {
+				t.Error("the payload is empty")
+			}
+
+			if tt.order.ID != 0 {
+				got.Data = data
+				order, err := got.Order()
+				if err != nil {
+					t.Fatalf("Order: %v", err)
+				}
+				gotJSON, _ := json.Marshal(order)
+				wantJSON, _ := json.Marshal(tt.order)
+				if string(gotJSON) != string(wantJSON) {
+					t.Errorf("Order = %s, want %s", gotJSON, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyIDs(t *testing.T) {
+	a, _ := Decode("order.created", []byte(`{"order_id": 1}`))
+	b, _ := Decode("order.created", []byte(`{"order_id": 2}`))
+	if a.ID == b.ID {
+		t.Errorf("different bodies have the same ID %q", a.ID)
+	}
+
+	// Without a timestamp the event is taken to have happened when it was read
+	before := time.Now().UTC()
+	if a.OccurredAt.Before(before.Add(-time.Minute)) || a.OccurredAt.After(before.Add(time.Minute)) {
+		t.Errorf("OccurredAt = %v, want about %v", a.OccurredAt, before)
+	}
+}
+
+func TestDecodeRefusesMalformedBodies(t *testing.T) {
+	for _, body := range []string{
+		``,
+		`not JSON`,
+		`{"id": "e1", "version": 1, "data": {`,
+		`[1, 2, 3]`,
+		`"order.created"`,
+		`{"id": "e1", "version": 1, "occurred_at": "yesterday", "data": {}}`,
+		`{"id": "e1", "version": 1, "location": "two", "data": {}}`,
+	} {
+		if _, err := Decode("loc.1.order.created", []byte(body)); err == nil {
+			t.Errorf("Decode(%q) succeeded", body)
+		}
+	}
+}
+
+func TestPayloadOfTheWrongShape(t *testing.T) {
+	e, err := Decode("loc.1.order.created", []byte(`{"id": "e1", "version": 1, "data": {"id": "seven"}}`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, err := e.Order(); err == nil {
+		t.Error("an order with a string ID was decoded")
+	}
+}
+
+func TestParseRoutingKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		location  int
+		eventType string
+	}{
+		{"loc.2.order.created", 2, OrderCreated},
+		{"loc.12.table.updated", 12, TableUpdated},
+		{"order.created", DefaultLocation, OrderCreated},
+		{"loc.0.order.created", DefaultLocation, "loc.0.order.created"},
+		{"loc.x.order.created", DefaultLocation, "loc.x.order.created"},
+		{"loc.3", DefaultLocation, "loc.3"},
+	}
+	for _, tt := range tests {
+		location, eventType := ParseRoutingKey(tt.key)
+		if location != tt.location || eventType != tt.eventType {
+			t.Errorf("ParseRoutingKey(%q) = %d, %q, want %d, %q", tt.key, location, eventType, tt.location, tt.eventType)
+		}
+	}
+}
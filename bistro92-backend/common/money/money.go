@@ -0,0 +1,238 @@
+// Package money holds the amount type shared by the Bistro-92 services.
+//
+// Amounts are kept in minor units (cents) so that totals and sums never drift the way
+// float64 prices do. All supported currencies use two decimal places.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts that come without a currency, such as
+// legacy float prices and DECIMAL columns read from Postgres.
+var DefaultCurrency = "USD"
+
+// Money is an amount in minor units of a currency.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New returns an amount of minor units in the given currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Parse reads a decimal amount such as "10.99" into minor units. Extra decimal
+// places are rounded half away from zero.
+func Parse(s string, currency string) (Money, error) {
+	amount, err := parseMinorUnits(s)
+	if err != nil {
+		return Money{}, err
+	}
+	return New(amount, currency), nil
+}
+
+// Add returns the sum of both amounts. A zero value without a currency takes
+// the currency of the other amount, so sums can start from Money{}. Adding amounts
+// in different currencies panics; amounts from outside are checked with SameCurrency
+// first.
+func (m Money) Add(o Money) Money {
+	return New(m.Amount+o.Amount, m.currencyWith(o, "add"))
+}
+
+// Sub returns m minus o. Like Add, it panics when the currencies differ.
+func (m Money) Sub(o Money) Money {
+	return New(m.Amount-o.Amount, m.currencyWith(o, "subtract"))
+}
+
+// SameCurrency reports whether both amounts can be added together: they are in the
+// same currency, or one of them has none.
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == "" || o.Currency == "" || m.Currency == o.Currency
+}
+
+// Mul multiplies the amount by a quantity.
+func (m Money) Mul(quantity int) Money {
+	return New(m.Amount*int64(quantity), m.Currency)
+}
+
+// Scale multiplies the amount by a factor such as a tax rate, rounding to the
+// nearest minor unit.
+func (m Money) Scale(factor float64) Money {
+	return New(int64(math.Round(float64(m.Amount)*factor)), m.Currency)
+}
+
+// IsZero reports whether the amount is zero, whatever the currency.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Decimal formats the amount in major units, e.g. "10.99".
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// String formats the amount with its currency, e.g. "10.99 USD".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// UnmarshalJSON accepts both the {"amount", "currency"} object and the plain
+// float prices stored in older orders and sent by older clients.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		type plain Money
+		var p plain
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*m = Money(p)
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+	}
+
+	// Legacy format: a JSON number (or numeric string) in major units
+	s := strings.Trim(string(data), `"`)
+	amount, err := parseMinorUnits(s)
+	if err != nil {
+		return fmt.Errorf("money: cannot decode %s: %w", data, err)
+	}
+	*m = New(amount, DefaultCurrency)
+	return nil
+}
+
+// Scan reads a DECIMAL column in major units.
+func (m *Money) Scan(src interface{}) error {
+	var amount int64
+	var err error
+
+	switch v := src.(type) {
+	case nil:
+		amount = 0
+	case []byte:
+		amount, err = parseMinorUnits(string(v))
+	case string:
+		amount, err = parseMinorUnits(v)
+	case int64:
+		amount = v * 100
+	case float64:
+		amount = int64(math.Round(v * 100))
+	default:
+		err = fmt.Errorf("money: cannot scan %T", src)
+	}
+	if err != nil {
+		return err
+	}
+
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	*m = New(amount, currency)
+	return nil
+}
+
+// Value writes the amount to a DECIMAL column in major units.
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
+
+func (m Money) currencyWith(o Money, operation string) string {
+	if !m.SameCurrency(o) {
+		panic(fmt.Sprintf("money: cannot %s %s and %s", operation, m, o))
+	}
+	if m.Currency == "" {
+		return o.Currency
+	}
+	return m.Currency
+}
+
+// parseMinorUnits converts a decimal string in major units to minor units
+// without going through float64.
+func parseMinorUnits(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		if math.Abs(f*100) >= math.MaxInt64 {
+			return 0, fmt.Errorf("amount %q is out of range", s)
+		}
+		return int64(math.Round(f * 100)), nil
+	}
+
+	negative := false
+	digits := s
+	switch digits[0] {
+	case '-':
+		negative = true
+		digits = digits[1:]
+	case '+':
+		digits = digits[1:]
+	}
+
+	// Only one sign, and at least one digit
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || strings.TrimLeft(whole, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("amount %q is out of range", s)
+	}
+
+	cents := int64(0)
+	for i := 0; i < 2; i++ {
+		cents *= 10
+		if i < len(frac) {
+			if frac[i] < '0' || frac[i] > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+			cents += int64(frac[i] - '0')
+		}
+	}
+	for i := 2; i < len(frac); i++ {
+		if frac[i] < '0' || frac[i] > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if len(frac) > 2 && frac[2] >= '5' {
+		cents++
+	}
+
+	amount := units*100 + cents
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
@@ -0,0 +1,178 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"10.99", 1099},
+		{"10", 1000},
+		{"10.9", 1090},
+		{"0.01", 1},
+		{".5", 50},
+		{"5.", 500},
+		{" 7.25 ", 725},
+		{"+3.10", 310},
+		{"-3.10", -310},
+		{"-0.5", -50},
+		{"007.00", 700},
+		// Extra decimal places round half away from zero
+		{"10.994", 1099},
+		{"10.995", 1100},
+		{"-10.995", -1100},
+		{"0.005", 1},
+		{"0.0049", 0},
+		{"1e2", 10000},
+		{"1.2345E1", 1235},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, "EUR")
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != New(tt.want, "EUR") {
+			t.Errorf("Parse(%q) = %v, want %d EUR minor units", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, in := range []string{
+		"", " ", "-", "+", ".", "-.", "--5", "+-5", "-+5", "++5", "5-", "1.2.3", "1.-5", "1,50", "ten",
+		"0x10", "1.5a", "NaN", "Inf", "1e400", "99999999999999999999", "92233720368547758.07",
+	} {
+		if got, err := Parse(in, DefaultCurrency); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m                Money
+		decimal, display string
+	}{
+		{New(1099, "USD"), "10.99", "10.99 USD"},
+		{New(5, "USD"), "0.05", "0.05 USD"},
+		{New(-5, "USD"), "-0.05", "-0.05 USD"},
+		{New(-1234, "EUR"), "-12.34", "-12.34 EUR"},
+		{New(100000, "EUR"), "1000.00", "1000.00 EUR"},
+		{Money{}, "0.00", "0.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.decimal {
+			t.Errorf("%#v.Decimal() = %q, want %q", tt.m, got, tt.decimal)
+		}
+		if got := tt.m.String(); got != tt.display {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.display)
+		}
+		if back, err := Parse(tt.m.Decimal(), tt.m.Currency); err != nil || back != tt.m {
+			t.Errorf("Parse(%q) = %v, %v, want %v", tt.m.Decimal(), back, err, tt.m)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		amount int64
+		factor float64
+		want   int64
+	}{
+		{1000, 0.1, 100},
+		{1099, 0.2, 220},   // 219.8
+		{1099, 0.08, 88},   // 87.92
+		{1050, 0.05, 53},   // 52.5 rounds away from zero
+		{-1050, 0.05, -53}, // and so does -52.5
+		{999, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := New(tt.amount, "USD").Scale(tt.factor); got != New(tt.want, "USD") {
+			t.Errorf("%d scaled by %v = %v, want %d", tt.amount, tt.factor, got, tt.want)
+		}
+	}
+}
+
+func TestAddAndSub(t *testing.T) {
+	usd := New(1000, "USD")
+	if got := (Money{}).Add(usd); got != usd {
+		t.Errorf("Money{} + %v = %v", usd, got)
+	}
+	if got := usd.Sub(New(250, "USD")); got != New(750, "USD") {
+		t.Errorf("%v - 2.50 USD = %v", usd, got)
+	}
+	if got := usd.Add(Money{}); got != usd {
+		t.Errorf("%v + Money{} = %v", usd, got)
+	}
+
+	for name, op := range map[string]func(){
+		"Add": func() { usd.Add(New(100, "EUR")) },
+		"Sub": func() { usd.Sub(New(100, "EUR")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of USD and EUR did not panic", name)
+				}
+			}()
+			op()
+		}()
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`{"amount": 1099, "currency": "EUR"}`, New(1099, "EUR")},
+		{`{"amount": 1099}`, New(1099, DefaultCurrency)},
+		{`10.99`, New(1099, DefaultCurrency)},
+		{`"10.99"`, New(1099, DefaultCurrency)},
+		{`12`, New(1200, DefaultCurrency)},
+		{`null`, Money{}},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"--5"`), &m); err == nil {
+		t.Errorf(`"--5" = %v, want an error`, m)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want int64
+	}{
+		{[]byte("10.99"), 1099},
+		{"-3.50", -350},
+		{int64(12), 1200},
+		{10.995, 1100},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%#v): %v", tt.src, err)
+			continue
+		}
+		if m != New(tt.want, DefaultCurrency) {
+			t.Errorf("Scan(%#v) = %v, want %d", tt.src, m, tt.want)
+		}
+	}
+}
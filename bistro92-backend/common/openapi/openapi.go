@@ -0,0 +1,191 @@
+// Package openapi checks a service against its OpenAPI 3 document: incoming requests
+// are validated against the operation they call, and the service's routes are
+// compared with the document's operations so that the two cannot drift apart.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Spec is a loaded and validated OpenAPI document
+type Spec struct {
+	raw    []byte
+	doc    *openapi3.T
+	router routers.Router
+}
+
+// New loads the OpenAPI document and checks that it is valid
+func New(data []byte) (*Spec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Spec{raw: data, doc: doc, router: router}, nil
+}
+
+// MustNew is New for documents embedded in the binary, which are fixed at build time
+func MustNew(data []byte) *Spec {
+	spec, err := New(data)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// JSON returns the document as it was loaded, to be served to clients
+func (s *Spec) JSON() []byte {
+	return s.raw
+}
+
+// FieldError is a problem with one field or parameter of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists what is wrong with a request. Malformed is set when the body
+// could not be parsed at all, as opposed to parsing into invalid values.
+type ValidationError struct {
+	Malformed bool
+	Fields    []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return "request does not match the API specification"
+	}
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = strings.TrimSpace(f.Field + " " + f.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the parameters and body of the request against the operation the
+// document defines for it, returning a *ValidationError. Requests for operations the
+// document does not define are left to the router to answer. The body stays readable
+// for the handler.
+func (s *Spec) Validate(r *http.Request) error {
+	route, pathParams, err := s.router.FindRoute(r)
+	if err != nil {
+		return nil
+	}
+
+	err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	if err == nil {
+		return nil
+	}
+
+	invalid := &ValidationError{}
+	collect(invalid, "", err)
+	return invalid
+}
+
+// collect flattens the errors returned by the validator into field errors. The errors
+// are matched one level at a time so that the parameter a nested error belongs to is
+// not skipped over.
+func collect(invalid *ValidationError, field string, err error) {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			collect(invalid, field, inner)
+		}
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			field = e.Parameter.Name
+		}
+		if e.Err == nil {
+			invalid.Fields = append(invalid.Fields, FieldError{Field: field, Message: e.Reason})
+			return
+		}
+		collect(invalid, field, e.Err)
+	case *openapi3filter.ParseError:
+		invalid.Malformed = true
+		if field != "" {
+			invalid.Fields = append(invalid.Fields, FieldError{Field: field, Message: "could not be parsed"})
+		}
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			field = strings.Join(pointer, ".")
+		}
+		invalid.Fields = append(invalid.Fields, FieldError{Field: field, Message: e.Reason})
+	default:
+		if inner := errors.Unwrap(err); inner != nil {
+			collect(invalid, field, inner)
+			return
+		}
+		invalid.Fields = append(invalid.Fields, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// Route is an operation served by a service. Path parameters may be written the gin
+// way (":id") or the OpenAPI way ("{id}").
+type Route struct {
+	Method string
+	Path   string
+}
+
+var ginParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// CheckRoutes compares the routes the service serves with the operations in the
+// document. The returned error lists routes missing from the document and operations
+// the service does not serve.
+func (s *Spec) CheckRoutes(routes []Route) error {
+	served := make(map[string]bool)
+	for _, route := range routes {
+		served[strings.ToUpper(route.Method)+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range s.doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var problems []string
+	for route := range served {
+		if !documented[route] {
+			problems = append(problems, route+" is served but not documented")
+		}
+	}
+	for operation := range documented {
+		if !served[operation] {
+			problems = append(problems, operation+" is documented but not served")
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	return fmt.Errorf("routes and OpenAPI document differ: %s", strings.Join(problems, "; "))
+}
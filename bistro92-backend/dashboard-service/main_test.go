@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/common/openapi"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	var err error
+	if signer, err = auth.NewSigner(strings.Repeat("s", auth.MinSecretLength)); err != nil {
+		panic(err)
+	}
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	var routes []openapi.Route
+	for _, route := range setupRouter().Routes() {
+		routes = append(routes, openapi.Route{Method: route.Method, Path: route.Path})
+	}
+	if err := spec.CheckRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Requests are validated against the OpenAPI document before authentication, so
+// these need no token; a valid request gets as far as the 401.
+func TestRequestValidation(t *testing.T) {
+	r := setupRouter()
+	tests := []struct {
+		name, path string
+		status     int
+		field      string
+	}{
+		{"valid", "/dashboard/tax?date=2025-01-31&location=2", http.StatusUnauthorized, ""},
+		{"location 0", "/dashboard/metrics?location=0", http.StatusUnprocessableEntity, "location"},
+		{"date that is not a date", "/dashboard/labor?date=yesterday", http.StatusUnprocessableEntity, "date"},
+		{"location that is not a number", "/dashboard/metrics?location=main", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.field != "" && !strings.Contains(w.Body.String(), `"field":"`+tt.field+`"`) {
+				t.Errorf("fields do not include %s: %s", tt.field, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleEventIgnoresOtherEvents(t *testing.T) {
+	if err := handleEvent(events.RoutingKey(1, events.OrderDeleted), []byte("not JSON")); err == nil {
+		t.Error("an event that is not JSON was accepted")
+	}
+	// Other events leave the cache alone, so Redis is not needed for them
+	if err := handleEvent(events.RoutingKey(1, events.OrderCreated), []byte(`{"id": 1}`)); err != nil {
+		t.Errorf("an event of another type was refused: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/bistro92/backend/notification-service
 go 1.23.6
 
 require (
+	github.com/bistro92/backend/common v0.0.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/streadway/amqp v1.1.0
 	go.temporal.io/sdk v1.34.0
@@ -34,3 +35,5 @@ require (
 	google.golang.org/protobuf v1.36.5 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/bistro92/backend/common => ../common
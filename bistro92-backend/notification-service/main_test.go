@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/common/events"
+)
+
+// matches reports whether a topic exchange delivers the routing key to the binding:
+// * stands for one word and # for any number of words
+func matches(binding, routingKey string) bool {
+	var match func(pattern, words []string) bool
+	match = func(pattern, words []string) bool {
+		if len(pattern) == 0 {
+			return len(words) == 0
+		}
+		if pattern[0] == "#" {
+			for i := 0; i <= len(words); i++ {
+				if match(pattern[1:], words[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(words) == 0 || pattern[0] != "*" && pattern[0] != words[0] {
+			return false
+		}
+		return match(pattern[1:], words[1:])
+	}
+	return match(strings.Split(binding, "."), strings.Split(routingKey, "."))
+}
+
+func TestEventBindings(t *testing.T) {
+	for _, eventType := range []string{
+		events.OrderCreated, events.OrderStatusChanged, events.OrderAmended, events.OrderCancelled,
+		events.OrderAssigned, events.OrderDeleted, events.MenuUpdated, events.TableUpdated,
+	} {
+		for _, key := range []string{events.RoutingKey(1, eventType), events.RoutingKey(12, eventType)} {
+			bound := false
+			for _, binding := range eventBindings {
+				bound = bound || matches(binding, key)
+			}
+			if !bound {
+				t.Errorf("%s is not bound", key)
+			}
+		}
+	}
+}
+
+func TestHandleEventRefusesUnreadableEvents(t *testing.T) {
+	if err := handleEvent(events.RoutingKey(1, events.OrderCreated), []byte("not JSON")); err == nil {
+		t.Error("an event that is not JSON was accepted")
+	}
+	if err := handleEvent(events.RoutingKey(1, "shift.started"), []byte(`{"id": 1}`)); err != nil {
+		t.Errorf("an event of another type was refused: %v", err)
+	}
+}
+
+func TestJoinRoomChecksTheAccount(t *testing.T) {
+	var err error
+	signer, err = auth.NewSigner(strings.Repeat("s", auth.MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(subject string) string {
+		token, _, err := signer.Sign(auth.Claims{Subject: subject, Role: auth.RoleChef, Location: 1}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// The order service knows staff member 1 as they are in the token, has deactivated
+	// or changed staff member 2 and fails for staff member 3
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := signer.Verify(auth.BearerToken(r))
+		switch {
+		case err != nil || claims.Subject == "2":
+			w.WriteHeader(http.StatusUnauthorized)
+		case claims.Subject == "1":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer orderService.Close()
+	orderServiceURL = orderService.URL
+
+	server := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		subject string
+		want    int
+	}{
+		{"current account", "1", http.StatusSwitchingProtocols},
+		{"deactivated or changed account", "2", http.StatusUnauthorized},
+		{"order service failing", "3", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"room": {"kitchen"}, "token": {sign(tt.subject)}}
+			conn, resp, _ := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?"+query.Encode(), nil)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatal("no response")
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyQueuesAreRead(t *testing.T) {
+	// What older producers put on each queue
+	bodies := map[string]string{
+		"order.created": `{"id": 7, "table_number": 3, "items": [{"ItemID": 1, "Name": "Soup", "Quantity": 2, "Price": 6.5}], "status": "Pending", "timestamp": "2024-05-17T19:30:00Z"}`,
+		"order.status":  `{"order_id": 7, "table_number": 3, "status": "Ready"}`,
+	}
+	for queue, eventType := range legacyQueues {
+		body, ok := bodies[queue]
+		if !ok {
+			t.Fatalf("no legacy body for queue %s", queue)
+		}
+		event, err := events.Decode(eventType, []byte(body))
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", queue, err)
+		}
+		order, err := event.Order()
+		if err != nil || order.ID != 7 || event.Location != events.DefaultLocation {
+			t.Errorf("%s: order %d at %d (%v), want order 7 at %d", queue, order.ID, event.Location, err, events.DefaultLocation)
+		}
+		if err := handleEvent(eventType, []byte(body)); err != nil {
+			t.Errorf("%s: handleEvent: %v", queue, err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// signer issues the tokens staff log in with; the other services verify them with the
+// same AUTH_SECRET
+var signer *auth.Signer
+
+// tokenTTL is how long a token from /auth/login stays valid
+var tokenTTL = 12 * time.Hour
+
+// claimsKey is where requireRole keeps the caller's claims in the gin context
+const claimsKey = "auth.claims"
+
+// Roles allowed on the routes, for requireRole. Admins are allowed everywhere.
+var (
+	anyStaff     = []string{auth.RoleServer, auth.RoleChef, auth.RoleManager}
+	floorStaff   = []string{auth.RoleServer, auth.RoleManager}
+	kitchenStaff = []string{auth.RoleChef, auth.RoleManager}
+	managers     = []string{auth.RoleManager}
+	admins       = []string{auth.RoleAdmin}
+)
+
+// dummyHash is compared against when a username does not exist, so that unknown
+// usernames take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("bistro92"), bcrypt.DefaultCost)
+
+// requireRole only lets requests through that carry a valid bearer token for one of
+// the roles. Missing or bad tokens are answered with 401, other roles with 403. The
+// request works at the staff member's location; see scopeLocation.
+// The account is looked up on every request, so tokens of staff who have since been
+// deactivated, given another role or moved to another location are refused with 401.
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := auth.BearerToken(c.Request)
+		if token == "" {
+			respondError(c, unauthorized("Log in to use this endpoint"))
+			return
+		}
+		claims, err := signer.Verify(token)
+		if errors.Is(err, auth.ErrExpiredToken) {
+			respondError(c, unauthorized("The session has expired, log in again"))
+			return
+		}
+		if err != nil {
+			respondError(c, unauthorized("The token is invalid"))
+			return
+		}
+		if err := checkAccount(context.Background(), claims); err != nil {
+			respondError(c, err)
+			return
+		}
+		if !claims.HasRole(roles...) {
+			respondError(c, &apiError{Status: http.StatusForbidden, Code: CodeForbidden, Message: "Your role is not allowed to do this"})
+			return
+		}
+		if !scopeLocation(c, claims) {
+			return
+		}
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// checkAccount checks that the staff member a token was issued to still has the
+// active account, role and location the token says
+func checkAccount(ctx context.Context, claims *auth.Claims) error {
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return unauthorized("The token is invalid")
+	}
+	staff, err := repos.Staff.GetStaff(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return unauthorized("The account no longer exists")
+	}
+	if err != nil {
+		return err
+	}
+	if !staff.Active {
+		return unauthorized("The account has been deactivated")
+	}
+	if staff.Role != claims.Role || staff.LocationID != claims.Location {
+		return unauthorized("The account has changed, log in again")
+	}
+	return nil
+}
+
+func unauthorized(message string) *apiError {
+	return &apiError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+// claimsFrom returns the claims requireRole accepted, or nil on public routes
+func claimsFrom(c *gin.Context) *auth.Claims {
+	claims, _ := c.Get(claimsKey)
+	cl, _ := claims.(*auth.Claims)
+	return cl
+}
+
+// staffIDFrom returns the ID of the logged in staff member
+func staffIDFrom(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(claimsFrom(c).Subject)
+	if err != nil {
+		return 0, unauthorized("The token is invalid")
+	}
+	return id, nil
+}
+
+// login checks a username and password and issues a token for the account
+func login(c *gin.Context) {
+	ctx := context.Background()
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	staff, err := repos.Staff.StaffByUsername(ctx, req.Username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		respondError(c, err)
+		return
+	}
+	hash := dummyHash
+	if staff != nil {
+		hash = []byte(staff.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || staff == nil || !staff.Active {
+		respondError(c, unauthorized("Wrong username or password"))
+		return
+	}
+
+	token, expires, err := signer.Sign(auth.Claims{
+		Subject:  strconv.Itoa(staff.ID),
+		Username: staff.Username,
+		Name:     staff.Name,
+		Role:     staff.Role,
+		Location: staff.LocationID,
+	}, tokenTTL)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expires, "staff": staff})
+}
+
+// getMe returns the account of the logged in staff member
+func getMe(c *gin.Context) {
+	ctx := context.Background()
+	id, err := staffIDFrom(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	staff, err := repos.Staff.GetStaff(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, staff)
+}
+
+// Staff handlers
+// getStaff lists the staff of the location the request works at
+func getStaff(c *gin.Context) {
+	ctx := context.Background()
+	staff, err := repos.Staff.ListStaff(ctx, locationFrom(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, staff)
+}
+
+// createStaff creates an account at the location in the request, by default the one
+// the request works at
+func createStaff(c *gin.Context) {
+	ctx := context.Background()
+	var req struct {
+		Username   string `json:"username" binding:"required,max=50"`
+		Name       string `json:"name" binding:"required,max=100"`
+		Role       string `json:"role" binding:"required,oneof=server chef manager admin"`
+		LocationID int    `json:"location_id" binding:"omitempty,min=1"`
+		Station    string `json:"station" binding:"max=30"`
+		Password   string `json:"password" binding:"required,min=8,max=72"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if req.LocationID == 0 {
+		req.LocationID = locationFrom(c)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	staff, err := repos.Staff.CreateStaff(ctx, store.Staff{
+		Username:     req.Username,
+		Name:         req.Name,
+		Role:         req.Role,
+		LocationID:   req.LocationID,
+		Station:      req.Station,
+		Active:       true,
+		PasswordHash: string(hash),
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, staff)
+}
+
+// updateStaff changes an account's name, role, location, station, active flag or
+// password. An empty station lets a chef cook at any station.
+// Deactivated staff cannot log in, and tokens already issued to them stop working, as
+// do those of staff given another role or location; see requireRole.
+func updateStaff(c *gin.Context) {
+	ctx := context.Background()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid staff ID"))
+		return
+	}
+	var req struct {
+		Name       *string `json:"name" binding:"omitempty,min=1,max=100"`
+		Role       *string `json:"role" binding:"omitempty,oneof=server chef manager admin"`
+		LocationID *int    `json:"location_id" binding:"omitempty,min=1"`
+		Station    *string `json:"station" binding:"omitempty,max=30"`
+		Active     *bool   `json:"active"`
+		Password   *string `json:"password" binding:"omitempty,min=8,max=72"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	staff, err := repos.Staff.GetStaff(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if req.Name != nil {
+		staff.Name = *req.Name
+	}
+	if req.Role != nil {
+		staff.Role = *req.Role
+	}
+	if req.LocationID != nil {
+		staff.LocationID = *req.LocationID
+	}
+	if req.Station != nil {
+		staff.Station = *req.Station
+	}
+	if req.Active != nil {
+		staff.Active = *req.Active
+	}
+	staff.PasswordHash = ""
+	if req.Password != nil {
+		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		staff.PasswordHash = string(hash)
+	}
+
+	staff, err = repos.Staff.UpdateStaff(ctx, *staff)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, staff)
+}
+
+// ensureAdmin creates the admin account from ADMIN_USERNAME and ADMIN_PASSWORD when it
+// does not exist yet, so that a fresh installation can be logged into. The account is
+// at the first location. An existing account is left alone.
+func ensureAdmin(ctx context.Context) error {
+	password := getEnv("ADMIN_PASSWORD", "")
+	if password == "" {
+		return nil
+	}
+	username := getEnv("ADMIN_USERNAME", "admin")
+
+	_, err := repos.Staff.StaffByUsername(ctx, username)
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = repos.Staff.CreateStaff(ctx, store.Staff{
+		Username:     username,
+		Name:         "Administrator",
+		Role:         auth.RoleAdmin,
+		LocationID:   events.DefaultLocation,
+		Active:       true,
+		PasswordHash: string(hash),
+	})
+	if errors.Is(err, store.ErrExists) {
+		return nil
+	}
+	if err == nil {
+		log.Printf("Created admin account %q", username)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+// Package broker publishes messages to RabbitMQ over a long-lived connection.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultConfirmTimeout is how long Publish waits for the broker to confirm a message
+const DefaultConfirmTimeout = 5 * time.Second
+
+// ErrNacked is returned when the broker refuses a message
+var ErrNacked = errors.New("message was nacked by the broker")
+
+// Publisher keeps one connection and channel open in confirm mode and re-dials when
+// they are lost. Publishes are serialised, each waiting for the broker's confirm, so a
+// nil error means the broker has taken responsibility for the message.
+type Publisher struct {
+	url            string
+	exchange       string
+	confirmTimeout time.Duration
+	dial           func(url, exchange string) (*session, error) // dialSession, or a fake in tests
+
+	mu      sync.Mutex
+	session *session
+}
+
+// channel is the part of an AMQP channel the publisher uses
+type channel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// session is an open channel in confirm mode with its notifications: the broker's
+// confirms, in publishing order, and the channel closing
+type session struct {
+	ch       channel
+	confirms chan amqp.Confirmation
+	closed   chan *amqp.Error
+	close    func() error // Closes the connection
+}
+
+// NewPublisher returns a publisher to the topic exchange of the broker at url. It
+// connects lazily, on the first publish.
+func NewPublisher(url, exchange string) *Publisher {
+	return &Publisher{url: url, exchange: exchange, confirmTimeout: DefaultConfirmTimeout, dial: dialSession}
+}
+
+// Publish sends a persistent JSON message to the exchange with the routing key, and
+// waits until the broker confirms it. The connection is dropped after any failure and
+// re-established on the next publish.
+func (p *Publisher) Publish(ctx context.Context, routingKey string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.connect(); err != nil {
+		return fmt.Errorf("connecting to RabbitMQ: %w", err)
+	}
+
+	err := p.publish(ctx, routingKey, body)
+	if err != nil {
+		p.reset()
+	}
+	return err
+}
+
+func (p *Publisher) publish(ctx context.Context, routingKey string, body []byte) error {
+	err := p.session.ch.Publish(p.exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+	})
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(p.confirmTimeout)
+	defer timer.Stop()
+
+	select {
+	case confirm, ok := <-p.session.confirms:
+		if !ok {
+			return errors.New("channel closed before the message was confirmed")
+		}
+		if !confirm.Ack {
+			return ErrNacked
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no confirm from the broker within %s", p.confirmTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect opens the connection and channel unless they are already open
+func (p *Publisher) connect() error {
+	if p.session != nil {
+		select {
+		case <-p.session.closed:
+			p.reset()
+		default:
+			return nil
+		}
+	}
+
+	s, err := p.dial(p.url, p.exchange)
+	if err != nil {
+		return err
+	}
+	p.session = s
+	return nil
+}
+
+// dialSession connects to the broker, declares the exchange and puts a channel in
+// confirm mode
+func dialSession(url, exchange string) (*session, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := ch.ExchangeDeclare(exchange, "topic", true, false, false, false, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &session{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		closed:   ch.NotifyClose(make(chan *amqp.Error, 1)),
+		close:    conn.Close,
+	}, nil
+}
+
+// reset closes the connection. A confirm that is still outstanding is discarded with
+// it, so confirms can never be matched to the wrong message.
+func (p *Publisher) reset() {
+	if p.session != nil {
+		p.session.close()
+	}
+	p.session = nil
+}
+
+// Close closes the connection
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reset()
+}
@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeChannel answers each publish the way the test says the broker would
+type fakeChannel struct {
+	s         *session
+	answer    func(s *session) // Called after a publish; nil sends no confirm
+	err       error            // Returned by Publish
+	published []string         // Routing keys
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.published = append(c.published, key)
+	if c.answer != nil {
+		c.answer(c.s)
+	}
+	return nil
+}
+
+func ack(s *session)  { s.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true} }
+func nack(s *session) { s.confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false} }
+
+// closeChannel is the channel closing before the broker confirms the message
+func closeChannel(s *session) { close(s.confirms) }
+
+// fakeBroker hands out sessions on fake channels and counts the dials and closes
+type fakeBroker struct {
+	channels []*fakeChannel
+	dialErr  error
+	closes   int
+}
+
+func (b *fakeBroker) dial(url, exchange string) (*session, error) {
+	if b.dialErr != nil {
+		return nil, b.dialErr
+	}
+	s := &session{
+		confirms: make(chan amqp.Confirmation, 1),
+		closed:   make(chan *amqp.Error, 1),
+		close:    func() error { b.closes++; return nil },
+	}
+	c := &fakeChannel{s: s, answer: ack}
+	s.ch = c
+	b.channels = append(b.channels, c)
+	return s, nil
+}
+
+func newTestPublisher(b *fakeBroker) *Publisher {
+	p := NewPublisher("amqp://test", "bistro.events")
+	p.dial = b.dial
+	p.confirmTimeout = 20 * time.Millisecond
+	return p
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  func(s *session)
+		err     error
+		wantErr string // Empty when the publish succeeds
+	}{
+		{"ack", ack, nil, ""},
+		{"nack", nack, nil, ErrNacked.Error()},
+		{"no confirm", nil, nil, "no confirm from the broker within 20ms"},
+		{"channel closed", closeChannel, nil, "channel closed before the message was confirmed"},
+		{"publish fails", ack, amqp.ErrClosed, amqp.ErrClosed.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBroker{}
+			p := newTestPublisher(b)
+			if err := p.Publish(context.Background(), "loc.1.order.created", []byte(`{}`)); err != nil {
+				t.Fatalf("first Publish: %v", err)
+			}
+			b.channels[0].answer, b.channels[0].err = tt.answer, tt.err
+
+			err := p.Publish(context.Background(), "loc.1.order.amended", []byte(`{}`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Publish: %v", err)
+				}
+				if b.closes != 0 {
+					t.Errorf("the connection was closed %d times after a confirmed publish", b.closes)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Publish: got %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantErr == ErrNacked.Error() && !errors.Is(err, ErrNacked) {
+				t.Errorf("got %v, want ErrNacked", err)
+			}
+
+			// The failed connection is dropped, so a late confirm cannot be taken for the
+			// next message's, and the next publish dials again
+			if b.closes != 1 {
+				t.Errorf("the connection was closed %d times, want once", b.closes)
+			}
+			if err := p.Publish(context.Background(), "loc.1.order.cancelled", []byte(`{}`)); err != nil {
+				t.Fatalf("Publish after the failure: %v", err)
+			}
+			if len(b.channels) != 2 || len(b.channels[1].published) != 1 {
+				t.Errorf("%d dials, want 2 with the last message on the new channel", len(b.channels))
+			}
+		})
+	}
+}
+
+func TestPublishRedialsAfterTheChannelCloses(t *testing.T) {
+	b := &fakeBroker{}
+	p := newTestPublisher(b)
+	if err := p.Publish(context.Background(), "loc.1.order.created", []byte(`{}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// The broker closes the channel between publishes
+	b.channels[0].s.closed <- amqp.ErrClosed
+	if err := p.Publish(context.Background(), "loc.1.order.created", []byte(`{}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(b.channels) != 2 || len(b.channels[0].published) != 1 || len(b.channels[1].published) != 1 {
+		t.Errorf("%d dials, want the second message on a new channel", len(b.channels))
+	}
+	if b.closes != 1 {
+		t.Errorf("the closed connection was closed %d times, want once", b.closes)
+	}
+}
+
+func TestPublishWaitsNoLongerThanTheContext(t *testing.T) {
+	b := &fakeBroker{}
+	p := newTestPublisher(b)
+	p.confirmTimeout = time.Minute
+	if err := p.Publish(context.Background(), "loc.1.order.created", []byte(`{}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	b.channels[0].answer = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Publish(ctx, "loc.1.order.created", []byte(`{}`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestPublishWithoutABroker(t *testing.T) {
+	b := &fakeBroker{dialErr: errors.New("connection refused")}
+	p := newTestPublisher(b)
+	err := p.Publish(context.Background(), "loc.1.order.created", []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "connecting to RabbitMQ: connection refused") {
+		t.Errorf("got %v, want the dial error", err)
+	}
+}
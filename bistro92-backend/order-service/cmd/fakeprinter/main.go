@@ -0,0 +1,98 @@
+// Command fakeprinter stands in for a raw TCP (port 9100) kitchen printer. Every
+// print job is written to disk as received, plus a readable copy with the ESC/POS
+// commands stripped.
+//
+//	go run ./cmd/fakeprinter -addr :9100 -dir ./tickets
+//	KITCHEN_PRINTERS="kitchen=localhost:9100" go run .
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+var jobCounter atomic.Int64
+
+func main() {
+	addr := flag.String("addr", ":9100", "address to listen on")
+	dir := flag.String("dir", "tickets", "directory to write print jobs to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Fake printer listening on %s, writing jobs to %s", *addr, *dir)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("Accept failed: %v", err)
+			continue
+		}
+		go handleJob(conn, *dir)
+	}
+}
+
+func handleJob(conn net.Conn, dir string) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		log.Printf("Reading job from %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	name := fmt.Sprintf("ticket-%s-%03d", time.Now().Format("20060102-150405"), jobCounter.Add(1))
+	if err := os.WriteFile(filepath.Join(dir, name+".bin"), data, 0o644); err != nil {
+		log.Printf("Writing job failed: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".txt"), stripCommands(data), 0o644); err != nil {
+		log.Printf("Writing job failed: %v", err)
+		return
+	}
+
+	log.Printf("Printed %s (%d bytes) from %s", name, len(data), conn.RemoteAddr())
+}
+
+// stripCommands removes the ESC/POS commands produced by the escpos package and
+// keeps the printable text.
+func stripCommands(data []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case 0x1b: // ESC @ takes no argument, ESC a/E/d take one
+			if i+1 < len(data) && data[i+1] == '@' {
+				i++
+			} else {
+				i += 2
+			}
+		case 0x1d: // GS V m n takes two arguments, GS !/B take one
+			if i+1 < len(data) && data[i+1] == 'V' {
+				i += 3
+			} else {
+				i += 2
+			}
+		default:
+			out.WriteByte(data[i])
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// Customer handlers; customers and their points are shared by all locations
+// getCustomers lists the customers, or those whose phone or email is the search term
+// or whose name contains it
+func getCustomers(c *gin.Context) {
+	customers, err := repos.Customers.ListCustomers(context.Background(), c.Query("search"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, customers)
+}
+
+func getCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid customer ID"))
+		return
+	}
+	customer, err := repos.Customers.GetCustomer(context.Background(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, customer)
+}
+
+// createCustomer enrols a customer in the loyalty programme. They are found again by
+// their phone number or email address, so at least one of them is required.
+func createCustomer(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required,max=100"`
+		Phone string `json:"phone" binding:"max=30"`
+		Email string `json:"email" binding:"omitempty,email,max=255"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if req.Phone == "" && req.Email == "" {
+		respondError(c, validationFailed("The request is invalid", FieldError{Field: "phone", Message: "phone or email is required"}))
+		return
+	}
+
+	customer, err := repos.Customers.CreateCustomer(context.Background(), store.Customer{
+		Name:  req.Name,
+		Phone: req.Phone,
+		Email: req.Email,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, customer)
+}
+
+// updateCustomer changes a customer's name, phone or email. An empty phone or email
+// removes it, as long as the other one is left. Points only change through orders.
+func updateCustomer(c *gin.Context) {
+	ctx := context.Background()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid customer ID"))
+		return
+	}
+	var req struct {
+		Name  *string `json:"name" binding:"omitempty,min=1,max=100"`
+		Phone *string `json:"phone" binding:"omitempty,max=30"`
+		Email *string `json:"email" binding:"omitempty,email,max=255"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	customer, err := repos.Customers.GetCustomer(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if req.Name != nil {
+		customer.Name = *req.Name
+	}
+	if req.Phone != nil {
+		customer.Phone = *req.Phone
+	}
+	if req.Email != nil {
+		customer.Email = *req.Email
+	}
+	if customer.Phone == "" && customer.Email == "" {
+		respondError(c, validationFailed("The request is invalid", FieldError{Field: "phone", Message: "phone or email is required"}))
+		return
+	}
+
+	updated, err := repos.Customers.UpdateCustomer(ctx, *customer)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// getCustomerPoints lists the points a customer earned, redeemed and had reversed,
+// newest first
+func getCustomerPoints(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid customer ID"))
+		return
+	}
+	history, err := repos.Customers.LoyaltyHistory(context.Background(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// checkCustomer checks the customer and points of a new order before its workflow
+// starts, since the workflow stores the order after the response is sent. The store
+// checks the balance again when it redeems the points.
+func checkCustomer(ctx context.Context, order store.Order) error {
+	if order.CustomerID == 0 {
+		if order.PointsRedeemed != 0 {
+			return validationFailed("The request is invalid", FieldError{Field: "PointsRedeemed", Message: "requires CustomerID"})
+		}
+		return nil
+	}
+	customer, err := repos.Customers.GetCustomer(ctx, order.CustomerID)
+	if errors.Is(err, store.ErrNotFound) {
+		return validationFailed("The request is invalid", FieldError{Field: "CustomerID", Message: err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	if order.PointsRedeemed > customer.Points {
+		message := fmt.Sprintf("customer %d has %d points, not %d", customer.ID, customer.Points, order.PointsRedeemed)
+		return validationFailed("The request is invalid", FieldError{Field: "PointsRedeemed", Message: message})
+	}
+	return nil
+}
@@ -1,52 +1,275 @@
 -- Drop existing tables if they exist (for clean reinstallation)
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS loyalty_transactions;
 DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS customers;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS shift_breaks;
+DROP TABLE IF EXISTS shifts;
 DROP TABLE IF EXISTS tables;
 DROP TABLE IF EXISTS menu_items;
 DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS order_events;
+DROP FUNCTION IF EXISTS reject_order_event_change;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS staff;
+DROP TABLE IF EXISTS locations;
+
+-- Restaurant locations. Menu items, tables, orders, notifications, staff and devices
+-- each belong to one; installations from before there were several run as location 1.
+CREATE TABLE locations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,  -- Printed on receipts
+    address VARCHAR(255),
+    phone VARCHAR(30),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO locations (name) VALUES ('Bistro-92');
 
 -- Menu items table
 CREATE TABLE menu_items (
     id SERIAL PRIMARY KEY,
+    location_id INT NOT NULL DEFAULT 1 REFERENCES locations(id),
     name VARCHAR(100) NOT NULL,
     price DECIMAL(10, 2) NOT NULL,
     category VARCHAR(50),
     prep_time INT DEFAULT 5, -- Estimated preparation time in minutes
-    image_url VARCHAR(255)
+    image_url VARCHAR(255),
+    station VARCHAR(30) DEFAULT 'kitchen', -- Where kitchen tickets for the item are printed
+    stock INT DEFAULT NULL                 -- Portions left, NULL when stock is not tracked
+);
+
+-- Tax rates per menu category
+CREATE TABLE tax_rates (
+    category VARCHAR(50) NOT NULL,             -- Matches menu_items.category
+    order_type VARCHAR(20) NOT NULL DEFAULT '' -- Only for orders of this type; '' for every type
+        CHECK (order_type IN ('', 'dine-in', 'takeaway', 'delivery')),
+    name VARCHAR(50) NOT NULL,                 -- Label used on receipts and tax reports
+    rate DECIMAL(6, 4) NOT NULL,               -- e.g. 0.0800 for 8%
+    inclusive BOOLEAN DEFAULT FALSE,           -- Menu prices already include the tax
+    PRIMARY KEY (category, order_type)
 );
 
 -- Tables table
 CREATE TABLE tables (
     id SERIAL PRIMARY KEY,
-    number INT UNIQUE NOT NULL,
+    location_id INT NOT NULL DEFAULT 1 REFERENCES locations(id),
+    number INT NOT NULL,
     status VARCHAR(20) DEFAULT 'Available',
-    capacity INT DEFAULT 4
+    capacity INT DEFAULT 4,
+    section VARCHAR(30),          -- The part of the floor the table is in, e.g. 'patio'
+    code_version INT NOT NULL DEFAULT 1, -- Signed into the table's QR code, incremented to rotate it
+    UNIQUE (location_id, number) -- Every location numbers its own tables
+);
+
+-- Staff accounts. The first admin is created from ADMIN_USERNAME and ADMIN_PASSWORD
+-- when the order service starts.
+CREATE TABLE staff (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('server', 'chef', 'manager', 'admin')),
+    location_id INT NOT NULL DEFAULT 1 REFERENCES locations(id), -- Where the staff member works
+    password_hash VARCHAR(100) NOT NULL, -- bcrypt
+    station VARCHAR(30),                 -- The station a chef cooks at, NULL for any station
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Shifts, scheduled ahead or started by clocking in without a schedule
+CREATE TABLE shifts (
+    id SERIAL PRIMARY KEY,
+    staff_id INT NOT NULL REFERENCES staff(id),
+    location_id INT NOT NULL REFERENCES locations(id),
+    section VARCHAR(30),          -- The floor section worked, NULL for all of it
+    scheduled_start TIMESTAMP,    -- NULL for unscheduled shifts
+    scheduled_end TIMESTAMP,
+    clock_in TIMESTAMP,           -- NULL until the shift starts
+    clock_out TIMESTAMP,          -- NULL while the shift is under way
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (scheduled_end > scheduled_start),
+    CHECK (clock_out >= clock_in)
+);
+
+-- Breaks taken during a shift; unpaid, so they do not count as labor
+CREATE TABLE shift_breaks (
+    id SERIAL PRIMARY KEY,
+    shift_id INT NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP            -- NULL while the break is under way
+);
+
+-- Guests who collect loyalty points. Customers are shared by every location.
+CREATE TABLE customers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    phone VARCHAR(30) UNIQUE,
+    email VARCHAR(255) UNIQUE,        -- Stored in lower case
+    points INT NOT NULL DEFAULT 0 CHECK (points >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (phone IS NOT NULL OR email IS NOT NULL)
 );
 
 -- Orders table with status tracking
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
-    table_number INT NOT NULL REFERENCES tables(number),
+    location_id INT NOT NULL DEFAULT 1 REFERENCES locations(id),
+    order_type VARCHAR(20) NOT NULL DEFAULT 'dine-in'
+        CHECK (order_type IN ('dine-in', 'takeaway', 'delivery')),
+    table_number INT,             -- Only dine-in orders have a table
+    customer_name VARCHAR(100),   -- Who takeaway and delivery orders are handed to
+    customer_phone VARCHAR(30),
+    pickup_time TIMESTAMP,        -- When a takeaway order is collected; as soon as ready when NULL
+    delivery_address VARCHAR(255),
     items JSONB NOT NULL,
     order_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    status VARCHAR(20) DEFAULT 'Pending',
-    assigned_to VARCHAR(100) DEFAULT NULL, -- Kept for backward compatibility but not used
+    status VARCHAR(20) DEFAULT 'Pending', -- The statuses depend on the order type
+    assigned_staff_id INT REFERENCES staff(id), -- The chef cooking the order
+    assigned_to VARCHAR(100) DEFAULT NULL, -- The chef's name when the order was assigned
+    handled_by_id INT REFERENCES staff(id), -- The clocked-in staff member who took the order
+    handled_by VARCHAR(100),                -- Their name when the order was taken
+    customer_id INT REFERENCES customers(id), -- The guest collecting points for the order
+    points_redeemed INT NOT NULL DEFAULT 0,   -- Loyalty points taken off the order
+    discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0, -- What the redeemed points are worth
+    workflow_id VARCHAR(100),                 -- The OrderWorkflow that placed the order
     completed_time TIMESTAMP,  -- When the order was completed
     notes TEXT,                -- Special instructions
-    total_amount DECIMAL(10, 2) -- Total order amount
+    total_amount DECIMAL(10, 2), -- Total order amount, including tax, less the discount
+    tax_amount DECIMAL(10, 2) DEFAULT 0, -- Tax part of the total
+    tax_breakdown JSONB DEFAULT '[]',    -- Tax per category, calculated when the order is stored
+    cancel_reason TEXT,                  -- Why the order was cancelled
+    cancelled_time TIMESTAMP,            -- When the order was cancelled
+    stock_restored BOOLEAN DEFAULT FALSE, -- Set once a cancelled order's items are back in stock
+    deleted_at TIMESTAMP,                -- Soft delete; purged after the retention period
+    deleted_by VARCHAR(100),
+    delete_reason TEXT,
+    version INT NOT NULL DEFAULT 1,      -- Incremented on every change, for optimistic concurrency
+    FOREIGN KEY (location_id, table_number) REFERENCES tables(location_id, number),
+    CHECK ((order_type = 'dine-in') = (table_number IS NOT NULL)),
+    CHECK (order_type = 'dine-in' OR customer_name IS NOT NULL AND customer_phone IS NOT NULL),
+    CHECK (order_type <> 'delivery' OR delivery_address IS NOT NULL)
+);
+
+-- Payments taken against an order
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id),
+    amount DECIMAL(10, 2) NOT NULL,
+    method VARCHAR(30),                 -- 'card', 'cash', ...
+    status VARCHAR(20) DEFAULT 'Pending', -- 'Pending', 'Captured', 'Voided'
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    voided_at TIMESTAMP
+);
+
+-- Changes to customers' points balances. An order earns points once, redeems them once
+-- and is reversed once, so retried workflow activities do not count twice. Like
+-- order_events there is no foreign key on orders, so purged orders keep their points.
+CREATE TABLE loyalty_transactions (
+    id SERIAL PRIMARY KEY,
+    customer_id INT NOT NULL REFERENCES customers(id),
+    order_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('earned', 'redeemed', 'reversed')),
+    points INT NOT NULL,              -- Negative when taken off the balance
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (order_id, kind)
 );
 
 -- Notifications table to track sent notifications
 CREATE TABLE notifications (
     id SERIAL PRIMARY KEY,
     order_id INT REFERENCES orders(id),
+    location_id INT NOT NULL DEFAULT 1 REFERENCES locations(id),
     notification_type VARCHAR(50) NOT NULL, -- 'new_order', 'status_change', etc.
     message TEXT,
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     status VARCHAR(20) DEFAULT 'Sent'
 );
 
+-- Append-only history of every change to an order. There is no foreign key on
+-- orders, so the history is kept when an order is deleted, and at its location when the
+-- order is purged.
+CREATE TABLE order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    location_id INT NOT NULL REFERENCES locations(id),
+    event_type VARCHAR(30) NOT NULL, -- 'created', 'amended', 'status_changed', 'cancelled', 'paid', 'deleted', 'assigned'
+    actor VARCHAR(100) NOT NULL DEFAULT 'system', -- Who made the change
+    occurred_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    previous JSONB,                  -- Values before the change
+    current JSONB                    -- Values after the change
+);
+
+CREATE FUNCTION reject_order_event_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_events_append_only
+    BEFORE UPDATE OR DELETE ON order_events
+    FOR EACH ROW EXECUTE FUNCTION reject_order_event_change();
+
+-- Idempotency-Key values of submitted orders, so that retried requests return the
+-- original order. Keys belong to the caller and location that sent them. Rows expire
+-- after the retention window and are purged nightly.
+CREATE TABLE idempotency_keys (
+    location_id INT NOT NULL REFERENCES locations(id),
+    caller VARCHAR(100) NOT NULL,    -- Staff member, device or table that sent the key
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,  -- SHA-256 of the request body
+    workflow_id VARCHAR(100) NOT NULL UNIQUE,
+    order_id INT,                    -- Set once the order is stored
+    response JSONB,                  -- Response to the first request
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (location_id, caller, key)
+);
+
+-- Messages for RabbitMQ, written in the same transaction as the change they announce
+-- and published by the outbox relay
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    routing_key VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,               -- NULL until published
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+-- Table terminals. Requests are signed with an HMAC under the secret, so it is kept as
+-- is; it is only shown when the device is registered or rotated.
+CREATE TABLE devices (
+    id VARCHAR(40) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    location_id INT NOT NULL,
+    table_number INT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMP,
+    revoked_at TIMESTAMP, -- Revoked devices are refused
+    FOREIGN KEY (location_id, table_number) REFERENCES tables(location_id, number)
+);
+
 -- Indexes
-CREATE INDEX idx_orders_order_time ON orders (order_time);
-CREATE INDEX idx_orders_table_number ON orders (table_number);
+CREATE INDEX idx_orders_order_time ON orders (order_time, id);
+CREATE INDEX idx_orders_items ON orders USING GIN (items jsonb_path_ops);
+CREATE INDEX idx_orders_location_table ON orders (location_id, table_number);
 CREATE INDEX idx_orders_status ON orders (status);
-CREATE INDEX idx_notifications_order_id ON notifications (order_id); 
\ No newline at end of file
+CREATE INDEX idx_orders_order_type ON orders (location_id, order_type) WHERE order_type <> 'dine-in';
+CREATE INDEX idx_shifts_location_start ON shifts (location_id, COALESCE(clock_in, scheduled_start));
+CREATE UNIQUE INDEX idx_shifts_open ON shifts (staff_id) WHERE clock_in IS NOT NULL AND clock_out IS NULL; -- One shift under way per staff member
+CREATE INDEX idx_shift_breaks_shift_id ON shift_breaks (shift_id);
+CREATE INDEX idx_orders_customer_id ON orders (customer_id) WHERE customer_id IS NOT NULL;
+CREATE INDEX idx_loyalty_transactions_customer_id ON loyalty_transactions (customer_id, created_at);
+CREATE INDEX idx_orders_assigned_staff_id ON orders (assigned_staff_id) WHERE assigned_staff_id IS NOT NULL;
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_payments_order_id ON payments (order_id);
+CREATE INDEX idx_order_events_order_id ON order_events (order_id, occurred_at);
+CREATE INDEX idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX idx_notifications_order_id ON notifications (order_id);
+CREATE INDEX idx_menu_items_location_id ON menu_items (location_id);
+CREATE INDEX idx_staff_location_id ON staff (location_id);
+CREATE INDEX idx_devices_location_id ON devices (location_id); 
\ No newline at end of file
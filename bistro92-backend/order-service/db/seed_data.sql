@@ -1,3 +1,7 @@
+-- A second location; everything else without a location is at the first one
+INSERT INTO locations (name, address, phone) VALUES
+('Bistro-92 Harbour', '12 Quay Street', '555-0192');
+
 -- Menu items with preparation times
 INSERT INTO menu_items (id, name, price, category, prep_time, image_url) VALUES
 (1, 'Pizza', 10.99, 'Main', 12, 'https://cdn.pixabay.com/photo/2017/12/09/08/18/pizza-3007395_1280.jpg'),
@@ -9,19 +13,50 @@ INSERT INTO menu_items (id, name, price, category, prep_time, image_url) VALUES
 (7, 'Pasta', 11.99, 'Main', 15, 'https://cdn.pixabay.com/photo/2018/07/18/19/12/pasta-3547078_1280.jpg'),
 (8, 'Ice Cream', 4.99, 'Dessert', 2, 'https://cdn.pixabay.com/photo/2016/03/23/15/00/ice-cream-1274894_1280.jpg');
 
+-- The harbour location has a smaller menu of its own
+INSERT INTO menu_items (id, location_id, name, price, category, prep_time, image_url) VALUES
+(9, 2, 'Fish and Chips', 12.99, 'Main', 14, 'https://cdn.pixabay.com/photo/2016/11/20/09/06/bowl-1842294_1280.jpg'),
+(10, 2, 'Soda', 2.99, 'Drink', 1, 'https://cdn.pixabay.com/photo/2019/11/11/15/32/soda-4619140_1280.jpg'),
+(11, 2, 'Coffee', 2.49, 'Drink', 3, 'https://cdn.pixabay.com/photo/2016/11/29/12/45/beverage-1869598_1280.jpg');
+
+-- Drinks are made at the bar, everything else in the kitchen
+UPDATE menu_items SET station = 'bar' WHERE category = 'Drink';
+
+-- Desserts are made in advance, so their portions are counted
+UPDATE menu_items SET stock = 40 WHERE category = 'Dessert';
+
 -- Reset sequence to ensure next ID is correct
 SELECT setval('menu_items_id_seq', (SELECT MAX(id) FROM menu_items));
 
+-- Tax rates per category; food taken away or delivered has its own lower rate
+INSERT INTO tax_rates (category, order_type, name, rate, inclusive) VALUES
+('Main', '', 'Food', 0.0800, FALSE),
+('Side', '', 'Food', 0.0800, FALSE),
+('Dessert', '', 'Food', 0.0800, FALSE),
+('Drink', '', 'Beverage', 0.1000, FALSE),
+('Alcohol', '', 'Alcohol', 0.2000, TRUE),
+('Main', 'takeaway', 'Takeaway', 0.0500, FALSE),
+('Side', 'takeaway', 'Takeaway', 0.0500, FALSE),
+('Dessert', 'takeaway', 'Takeaway', 0.0500, FALSE),
+('Main', 'delivery', 'Takeaway', 0.0500, FALSE),
+('Side', 'delivery', 'Takeaway', 0.0500, FALSE),
+('Dessert', 'delivery', 'Takeaway', 0.0500, FALSE);
+
 -- Create some tables
-INSERT INTO tables (number, status, capacity) VALUES
-(1, 'Available', 2),
-(2, 'Available', 4),
-(3, 'Available', 4),
-(4, 'Available', 6),
-(5, 'Available', 8),
-(10, 'Available', 2),
-(11, 'Available', 2),
-(12, 'Available', 4);
+INSERT INTO tables (number, status, capacity, section) VALUES
+(1, 'Available', 2, 'main'),
+(2, 'Available', 4, 'main'),
+(3, 'Available', 4, 'main'),
+(4, 'Available', 6, 'main'),
+(5, 'Available', 8, 'main'),
+(10, 'Available', 2, 'patio'),
+(11, 'Available', 2, 'patio'),
+(12, 'Available', 4, 'patio');
+
+INSERT INTO tables (location_id, number, status, capacity) VALUES
+(2, 1, 'Available', 2),
+(2, 2, 'Available', 4),
+(2, 3, 'Available', 6);
 
 -- Sample order 1 - Pending
 INSERT INTO orders (table_number, items, status, total_amount) VALUES
@@ -45,6 +80,10 @@ INSERT INTO orders (table_number, items, status, total_amount) VALUES
   {"ItemID": 5, "Name": "Salad", "Price": 6.99, "Quantity": 1}
 ]'::jsonb, 'Ready', 30.97);
 
+-- Sample loyalty customer
+INSERT INTO customers (name, phone, email, points) VALUES
+('Maria Lopez', '+1 555 0100', 'maria@example.com', 240);
+
 -- Sample notifications
 INSERT INTO notifications (order_id, notification_type, message) VALUES
 (1, 'new_order', 'New order received for table 3'),
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// deviceClockSkew is how far a device's timestamp may be from the service's clock
+const deviceClockSkew = 5 * time.Minute
+
+// deviceKey is where authenticateDevice keeps the device in the gin context
+const deviceKey = "auth.device"
+
+// seenSignatures remembers the device signatures accepted while their timestamps are
+// still within the clock skew window, so that a captured request cannot be sent again.
+// It is kept per process.
+var seenSignatures = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+// requireRoleOrDevice lets requests through that are signed by a table device, or
+// otherwise carry a staff token for one of the roles
+func requireRoleOrDevice(roles ...string) gin.HandlerFunc {
+	staff := requireRole(roles...)
+	return func(c *gin.Context) {
+		if c.GetHeader(auth.DeviceIDHeader) == "" {
+			staff(c)
+			return
+		}
+		authenticateDevice(c)
+	}
+}
+
+// authenticateDevice checks the signature of a request from a table device. The
+// signature covers the timestamp, method, path and body; see auth.SignDeviceRequest.
+func authenticateDevice(c *gin.Context) {
+	ctx := context.Background()
+	timestamp, err := strconv.ParseInt(c.GetHeader(auth.DeviceTimestampHeader), 10, 64)
+	if err != nil {
+		respondError(c, unauthorized("The request timestamp is missing or invalid"))
+		return
+	}
+	now := time.Now()
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > deviceClockSkew || skew < -deviceClockSkew {
+		respondError(c, unauthorized("The request timestamp is too far from the current time"))
+		return
+	}
+
+	device, err := repos.Devices.GetDevice(ctx, c.GetHeader(auth.DeviceIDHeader))
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(c, unauthorized("Unknown device"))
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if device.RevokedAt != nil {
+		respondError(c, unauthorized("The device has been revoked"))
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, badRequest("The request body could not be read"))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	signature := c.GetHeader(auth.DeviceSignatureHeader)
+	if !auth.VerifyDeviceRequest(device.Secret, signature, timestamp, c.Request.Method, c.Request.URL.Path, body) {
+		respondError(c, unauthorized("The request signature is invalid"))
+		return
+	}
+	if !claimSignature(signature, now) {
+		respondError(c, unauthorized("The request was already received, sign it again with a new timestamp"))
+		return
+	}
+
+	c.Set(deviceKey, device)
+	c.Set(locationKey, device.LocationID)
+	c.Next()
+}
+
+// claimSignature records a signature as used and reports whether it was new
+func claimSignature(signature string, now time.Time) bool {
+	seenSignatures.Lock()
+	defer seenSignatures.Unlock()
+
+	for seen, expires := range seenSignatures.expires {
+		if now.After(expires) {
+			delete(seenSignatures.expires, seen)
+		}
+	}
+	if _, ok := seenSignatures.expires[signature]; ok {
+		return false
+	}
+	seenSignatures.expires[signature] = now.Add(2 * deviceClockSkew)
+	return true
+}
+
+// deviceFrom returns the device that signed the request, or nil
+func deviceFrom(c *gin.Context) *store.Device {
+	device, _ := c.Get(deviceKey)
+	d, _ := device.(*store.Device)
+	return d
+}
+
+// Device handlers
+func getDevices(c *gin.Context) {
+	ctx := context.Background()
+	devices, err := repos.Devices.ListDevices(ctx, locationFrom(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// createDevice registers a terminal for a table of the location the request works at.
+// The secret is in the response only; it has to be flashed onto the device.
+func createDevice(c *gin.Context) {
+	ctx := context.Background()
+	var req struct {
+		Name        string `json:"name" binding:"required,max=100"`
+		TableNumber int    `json:"table_number" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	device, err := repos.Devices.CreateDevice(ctx, store.Device{
+		ID:          "dev_" + randomHex(8),
+		Name:        req.Name,
+		LocationID:  locationFrom(c),
+		TableNumber: req.TableNumber,
+		Secret:      randomHex(32),
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"device": device, "secret": device.Secret})
+}
+
+// rotateDeviceSecret gives a device a new secret; requests signed with the old one are
+// refused from now on
+func rotateDeviceSecret(c *gin.Context) {
+	ctx := context.Background()
+	device, err := repos.Devices.RotateDeviceSecret(ctx, c.Param("id"), randomHex(32))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": device, "secret": device.Secret})
+}
+
+func revokeDevice(c *gin.Context) {
+	ctx := context.Background()
+	device, err := repos.Devices.RevokeDevice(ctx, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// deviceActor is how a device is recorded in the order history
+func deviceActor(device *store.Device) string {
+	return fmt.Sprintf("%s (device, table %d)", device.Name, device.TableNumber)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
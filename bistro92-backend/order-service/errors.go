@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.temporal.io/api/serviceerror"
+	sdktemporal "go.temporal.io/sdk/temporal"
+
+	"github.com/bistro92/backend/common/openapi"
+	"github.com/bistro92/backend/order-service/store"
+	"github.com/bistro92/backend/order-service/temporal"
+)
+
+// Error codes sent in the error envelope. Clients should branch on the code, the
+// message is for people and may change.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeConfirmationRequired = "confirmation_required"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodePreconditionRequired = "precondition_required"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeUnavailable          = "unavailable"
+	CodeInternal             = "internal"
+)
+
+// requestIDHeader carries the ID of a request. A client or proxy may set it to
+// correlate its logs with ours; otherwise one is generated.
+const requestIDHeader = "X-Request-ID"
+
+// FieldError is a problem with one field of the request
+type FieldError = openapi.FieldError
+
+// apiError is an error together with the response it is answered with. Err is the
+// cause; it is logged but never sent to the client.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *apiError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *apiError) Unwrap() error { return e.Err }
+
+// errorEnvelope is the body of every error response
+type errorEnvelope struct {
+	Error struct {
+		Code      string       `json:"code"`
+		Message   string       `json:"message"`
+		Fields    []FieldError `json:"fields,omitempty"`
+		RequestID string       `json:"request_id"`
+	} `json:"error"`
+}
+
+func badRequest(message string, fields ...FieldError) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: message, Fields: fields}
+}
+
+// invalidParam reports a path or query parameter that could not be read
+func invalidParam(field, message string) *apiError {
+	return badRequest(message, FieldError{Field: field, Message: message})
+}
+
+func validationFailed(message string, fields ...FieldError) *apiError {
+	return &apiError{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: message, Fields: fields}
+}
+
+func notFound(message string) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func conflict(code, message string) *apiError {
+	return &apiError{Status: http.StatusConflict, Code: code, Message: message}
+}
+
+// respondError answers the request with the error envelope. Errors that are not
+// recognised are answered with a generic 500 and logged with the request ID, so that
+// database and Temporal messages do not reach the client.
+func respondError(c *gin.Context, err error) {
+	e := classify(err)
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("Request %s %s %s failed: %v", requestIDFrom(c), c.Request.Method, c.Request.URL.Path, err)
+	}
+
+	var body errorEnvelope
+	body.Error.Code = e.Code
+	body.Error.Message = e.Message
+	body.Error.Fields = e.Fields
+	body.Error.RequestID = requestIDFrom(c)
+	c.AbortWithStatusJSON(e.Status, body)
+}
+
+// classify maps an error to the response for it: errors built by the handlers as
+// they are, business errors from the store and the workflows by their type, and
+// connection failures to 503. Requests the store refuses as invalid get the same 422
+// as those that fail validation in the handlers.
+func classify(err error) *apiError {
+	var e *apiError
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var appErr *sdktemporal.ApplicationError
+	if errors.As(err, &appErr) {
+		switch appErr.Type() {
+		case temporal.ErrTypeNotFound:
+			return notFound(appErr.Message())
+		case temporal.ErrTypeInvalid:
+			return validationFailed(appErr.Message())
+		case temporal.ErrTypeOrderClosed:
+			return conflict(CodeConflict, appErr.Message())
+		case temporal.ErrTypeConfirmationRequired:
+			return conflict(CodeConfirmationRequired, appErr.Message())
+		case temporal.ErrTypeVersionMismatch:
+			return &apiError{Status: http.StatusPreconditionFailed, Code: CodePreconditionFailed, Message: appErr.Message()}
+		}
+	}
+
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return notFound(err.Error())
+	case errors.Is(err, store.ErrInvalid):
+		return validationFailed(err.Error())
+	case errors.Is(err, store.ErrOrderClosed):
+		return conflict(CodeConflict, err.Error())
+	case errors.Is(err, store.ErrConfirmationRequired):
+		return conflict(CodeConfirmationRequired, err.Error())
+	case errors.Is(err, store.ErrExists):
+		return conflict(CodeConflict, err.Error())
+	case errors.Is(err, store.ErrVersionMismatch):
+		return &apiError{Status: http.StatusPreconditionFailed, Code: CodePreconditionFailed, Message: err.Error()}
+	}
+
+	if unavailable(err) {
+		return &apiError{
+			Status:  http.StatusServiceUnavailable,
+			Code:    CodeUnavailable,
+			Message: "The service is temporarily unavailable, please try again",
+			Err:     err,
+		}
+	}
+
+	return &apiError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+// unavailable reports whether the error comes from a backing service that could not
+// be reached, so that retrying later may succeed
+func unavailable(err error) bool {
+	var temporalUnavailable *serviceerror.Unavailable
+	var opErr *net.OpError
+	return errors.As(err, &temporalUnavailable) ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// bindError turns an error from binding the request body into a response. Bodies that
+// are not JSON are bad requests; JSON that does not satisfy the request is reported
+// field by field.
+func bindError(err error) *apiError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			fields[i] = FieldError{Field: fieldPath(fe), Message: validationMessage(fe)}
+		}
+		return validationFailed("The request is invalid", fields...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		message := fmt.Sprintf("must be a %s", typeErr.Type.Kind())
+		return validationFailed("The request is invalid", FieldError{Field: typeErr.Field, Message: message})
+	}
+
+	if errors.Is(err, io.EOF) {
+		return badRequest("The request body is empty")
+	}
+	return &apiError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "The request body is not valid JSON", Err: err}
+}
+
+// fieldPath is the JSON path of the field, without the name of the request struct
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "min", "gte":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters long"
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		return "must be at most " + fe.Param()
+	}
+	return "is invalid"
+}
+
+// jsonFieldName names struct fields in validation errors after their JSON key
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// withRequestID gives every request an ID, sent back in the X-Request-ID header and
+// in error responses
+func withRequestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	c.Set(requestIDHeader, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+func requestIDFrom(c *gin.Context) string {
+	return c.GetString(requestIDHeader)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	sdktemporal "go.temporal.io/sdk/temporal"
+
+	"github.com/bistro92/backend/order-service/store"
+	"github.com/bistro92/backend/order-service/temporal"
+)
+
+func TestClassify(t *testing.T) {
+	appErr := func(errType string) error {
+		return fmt.Errorf("workflow failed: %w", sdktemporal.NewNonRetryableApplicationError("refused", errType, nil))
+	}
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"store invalid", fmt.Errorf("order 1: %w", store.ErrInvalid), http.StatusUnprocessableEntity, CodeValidation},
+		{"workflow invalid", appErr(temporal.ErrTypeInvalid), http.StatusUnprocessableEntity, CodeValidation},
+		{"store not found", store.ErrNotFound, http.StatusNotFound, CodeNotFound},
+		{"workflow not found", appErr(temporal.ErrTypeNotFound), http.StatusNotFound, CodeNotFound},
+		{"store closed", store.ErrOrderClosed, http.StatusConflict, CodeConflict},
+		{"workflow closed", appErr(temporal.ErrTypeOrderClosed), http.StatusConflict, CodeConflict},
+		{"workflow confirmation", appErr(temporal.ErrTypeConfirmationRequired), http.StatusConflict, CodeConfirmationRequired},
+		{"store version", store.ErrVersionMismatch, http.StatusPreconditionFailed, CodePreconditionFailed},
+		{"unknown", errors.New("disk full"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := classify(tt.err)
+			if e.Status != tt.status || e.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", e.Status, e.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package escpos builds raw ESC/POS command streams for thermal receipt printers.
+package escpos
+
+import "bytes"
+
+const (
+	esc = 0x1b
+	gs  = 0x1d
+)
+
+type Alignment byte
+
+const (
+	AlignLeft   Alignment = 0
+	AlignCenter Alignment = 1
+	AlignRight  Alignment = 2
+)
+
+// Builder accumulates printer commands and text. Methods return the builder so
+// that calls can be chained.
+type Builder struct {
+	buf bytes.Buffer
+}
+
+// New returns a builder that starts by resetting the printer.
+func New() *Builder {
+	b := &Builder{}
+	b.buf.Write([]byte{esc, '@'})
+	return b
+}
+
+func (b *Builder) Align(a Alignment) *Builder {
+	b.buf.Write([]byte{esc, 'a', byte(a)})
+	return b
+}
+
+func (b *Builder) Bold(on bool) *Builder {
+	b.buf.Write([]byte{esc, 'E', flag(on)})
+	return b
+}
+
+// Size sets the character magnification, 1 to 8 times in each direction.
+func (b *Builder) Size(width, height int) *Builder {
+	b.buf.Write([]byte{gs, '!', byte((clamp(width)-1)<<4 | (clamp(height) - 1))})
+	return b
+}
+
+// Invert switches white-on-black printing on or off.
+func (b *Builder) Invert(on bool) *Builder {
+	b.buf.Write([]byte{gs, 'B', flag(on)})
+	return b
+}
+
+// Line prints the text followed by a line feed. Characters outside ASCII are
+// replaced, since printers default to a single-byte code page.
+func (b *Builder) Line(text string) *Builder {
+	for _, r := range text {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		b.buf.WriteByte(byte(r))
+	}
+	b.buf.WriteByte('\n')
+	return b
+}
+
+// Feed prints and feeds the paper by n lines.
+func (b *Builder) Feed(n int) *Builder {
+	b.buf.Write([]byte{esc, 'd', byte(n)})
+	return b
+}
+
+// Cut feeds the paper to the cutter and makes a partial cut.
+func (b *Builder) Cut() *Builder {
+	b.buf.Write([]byte{gs, 'V', 66, 3})
+	return b
+}
+
+func (b *Builder) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func flag(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+func clamp(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > 8 {
+		return 8
+	}
+	return n
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/common/money"
+	"github.com/bistro92/backend/order-service/qrcode"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// guestOrderURL is the page of the guest ordering app the table QR codes open. The
+// table's token is added as the t query parameter.
+var guestOrderURL string
+
+// qrScale is the size of a QR code module in pixels, enough for a printed table card
+const qrScale = 10
+
+// guestTableKey is where authenticateTable keeps the table in the gin context
+const guestTableKey = "auth.table"
+
+// authenticateTable lets requests through that carry the token of a table's current
+// QR code, and scopes them to that table and its location
+func authenticateTable(c *gin.Context) {
+	claims, err := signer.VerifyTable(c.GetHeader(auth.TableTokenHeader))
+	if err != nil {
+		respondError(c, unauthorized("The table code is missing or invalid"))
+		return
+	}
+	table, err := repos.Tables.GetTable(context.Background(), claims.Location, claims.Table)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(c, unauthorized("Unknown table"))
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if table.CodeVersion != claims.Version {
+		respondError(c, unauthorized("The table code has been replaced, scan the code on the table again"))
+		return
+	}
+
+	c.Set(guestTableKey, table)
+	c.Set(locationKey, table.LocationID)
+	c.Next()
+}
+
+// guestTableFrom returns the table whose QR code the guest scanned, or nil
+func guestTableFrom(c *gin.Context) *store.Table {
+	table, _ := c.Get(guestTableKey)
+	t, _ := table.(*store.Table)
+	return t
+}
+
+// selfOrderTable returns the table a device or a guest orders for, or 0 when staff
+// make the request
+func selfOrderTable(c *gin.Context) int {
+	if device := deviceFrom(c); device != nil {
+		return device.TableNumber
+	}
+	if table := guestTableFrom(c); table != nil {
+		return table.Number
+	}
+	return 0
+}
+
+// guestActor is how a guest ordering at a table is recorded in the order history
+func guestActor(table *store.Table) string {
+	return fmt.Sprintf("Guest (QR code, table %d)", table.Number)
+}
+
+// Table QR code handlers
+// getTableQR returns the table's current QR code as a PNG to print, or with
+// format=json the token and the URL it encodes
+func getTableQR(c *gin.Context) {
+	table, ok := tableParam(c)
+	if !ok {
+		return
+	}
+	tableQR(c, table)
+}
+
+// rotateTableQR replaces the table's QR code, e.g. when a printed code was taken away;
+// the codes printed before stop working. It answers like getTableQR.
+func rotateTableQR(c *gin.Context) {
+	table, ok := tableParam(c)
+	if !ok {
+		return
+	}
+	rotated, err := repos.Tables.RotateTableCode(context.Background(), table.LocationID, table.Number)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	tableQR(c, rotated)
+}
+
+// tableParam looks up the table in the path at the location the request works at
+func tableParam(c *gin.Context) (*store.Table, bool) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		respondError(c, invalidParam("number", "Invalid table number"))
+		return nil, false
+	}
+	table, err := repos.Tables.GetTable(context.Background(), locationFrom(c), number)
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return table, true
+}
+
+func tableQR(c *gin.Context, table *store.Table) {
+	token, err := signer.SignTable(auth.TableClaims{Location: table.LocationID, Table: table.Number, Version: table.CodeVersion})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	link, err := url.Parse(guestOrderURL)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	query := link.Query()
+	query.Set("t", token)
+	link.RawQuery = query.Encode()
+
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		code, err := qrcode.Encode(link.String())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		image, err := code.PNG(qrScale)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="table-%d.png"`, table.Number))
+		c.Data(http.StatusOK, "image/png", image)
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"table": table, "token": token, "url": link.String()})
+	default:
+		respondError(c, invalidParam("format", "format must be png or json"))
+	}
+}
+
+// guestOrder is what guests see of an order: no staff, tax or loyalty details
+type guestOrder struct {
+	ID          int               `json:"id"`
+	TableNumber int               `json:"table_number"`
+	Items       []store.OrderItem `json:"items"`
+	Status      string            `json:"status"`
+	TotalAmount money.Money       `json:"total_amount"`
+	OrderTime   time.Time         `json:"order_time"`
+	Notes       string            `json:"notes,omitempty"`
+}
+
+func toGuestOrder(order store.Order) guestOrder {
+	return guestOrder{
+		ID:          order.ID,
+		TableNumber: order.TableNumber,
+		Items:       order.Items,
+		Status:      order.Status,
+		TotalAmount: order.TotalAmount,
+		OrderTime:   order.OrderTime,
+		Notes:       order.Notes,
+	}
+}
+
+// Guest handlers; guests only see the open orders of the table they scanned
+// getGuestOrders lists the table's open orders, oldest first
+func getGuestOrders(c *gin.Context) {
+	table := guestTableFrom(c)
+	orders, err := repos.Orders.OpenTableOrders(context.Background(), table.LocationID, table.Number)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	result := make([]guestOrder, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, toGuestOrder(order))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getGuestOrder returns one of the table's open orders. Other orders, including the
+// table's closed ones, are not found.
+func getGuestOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid order ID"))
+		return
+	}
+	table := guestTableFrom(c)
+	orders, err := repos.Orders.OpenTableOrders(context.Background(), table.LocationID, table.Number)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	for _, order := range orders {
+		if order.ID == id {
+			c.JSON(http.StatusOK, toGuestOrder(order))
+			return
+		}
+	}
+	respondError(c, notFound(fmt.Sprintf("order %d not found", id)))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// locationHeader lets admins work at another location than their own
+const locationHeader = "X-Location-ID"
+
+// locationKey is where the location a request works at is kept in the gin context
+const locationKey = "auth.location"
+
+// scopeLocation sets the location the request works at: the staff member's own, or for
+// admins the one in the X-Location-ID header. Other staff may only send their own
+// location. It answers the request and returns false when the location is not allowed.
+func scopeLocation(c *gin.Context, claims *auth.Claims) bool {
+	location := claims.Location
+	if header := c.GetHeader(locationHeader); header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil || id <= 0 {
+			respondError(c, invalidParam(locationHeader, locationHeader+" must be a location ID"))
+			return false
+		}
+		if id != claims.Location && claims.Role != auth.RoleAdmin {
+			respondError(c, &apiError{Status: http.StatusForbidden, Code: CodeForbidden, Message: "You can only work at your own location"})
+			return false
+		}
+		if _, err := repos.Locations.GetLocation(context.Background(), id); err != nil {
+			respondError(c, err)
+			return false
+		}
+		location = id
+	}
+	c.Set(locationKey, location)
+	return true
+}
+
+// locationFrom returns the location the request works at, as set by requireRole or,
+// for table devices, authenticateDevice
+func locationFrom(c *gin.Context) int {
+	return c.GetInt(locationKey)
+}
+
+// orderAtLocation answers requests for orders of other locations as if the order did
+// not exist
+func orderAtLocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid order ID"))
+		return
+	}
+	order, err := repos.Orders.GetOrder(context.Background(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if order.LocationID != locationFrom(c) {
+		respondError(c, notFound(fmt.Sprintf("order %d not found", id)))
+		return
+	}
+	c.Next()
+}
+
+// deviceAtLocation answers requests for devices of other locations as if the device did
+// not exist
+func deviceAtLocation(c *gin.Context) {
+	device, err := repos.Devices.GetDevice(context.Background(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if device.LocationID != locationFrom(c) {
+		respondError(c, notFound(fmt.Sprintf("device %s not found", device.ID)))
+		return
+	}
+	c.Next()
+}
+
+// Location handlers
+func getLocations(c *gin.Context) {
+	ctx := context.Background()
+	locations, err := repos.Locations.ListLocations(ctx)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, locations)
+}
+
+// createLocation opens a new location. It starts without menu items, tables or staff.
+func createLocation(c *gin.Context) {
+	ctx := context.Background()
+	var req struct {
+		Name    string `json:"name" binding:"required,max=100"`
+		Address string `json:"address" binding:"max=255"`
+		Phone   string `json:"phone" binding:"max=30"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	location, err := repos.Locations.CreateLocation(ctx, store.Location{
+		Name:    req.Name,
+		Address: req.Address,
+		Phone:   req.Phone,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, location)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/auth"
+	"github.com/bistro92/backend/common/openapi"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	var routes []openapi.Route
+	for _, route := range setupRouter().Routes() {
+		routes = append(routes, openapi.Route{Method: route.Method, Path: route.Path})
+	}
+	if err := spec.CheckRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Requests are validated against the OpenAPI document before authentication, so
+// these need no token; a valid request gets as far as the 401.
+func TestRequestValidation(t *testing.T) {
+	r := setupRouter()
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code, field              string
+	}{
+		{"valid order", "POST", "/orders", `{"TableNumber": 3, "Items": [{"ItemID": 1, "Quantity": 1}]}`, http.StatusUnauthorized, CodeUnauthorized, ""},
+		{"quantity 0", "POST", "/orders", `{"TableNumber": 3, "Items": [{"ItemID": 1, "Quantity": 0}]}`, http.StatusUnprocessableEntity, CodeValidation, "Items.0.Quantity"},
+		{"no items", "POST", "/orders", `{"TableNumber": 3, "Items": []}`, http.StatusUnprocessableEntity, CodeValidation, "Items"},
+		{"unknown order type", "POST", "/orders", `{"Type": "drive-through", "Items": [{"ItemID": 1, "Quantity": 1}]}`, http.StatusUnprocessableEntity, CodeValidation, "Type"},
+		{"no items to add", "POST", "/orders/1/items", `{"Items": []}`, http.StatusUnprocessableEntity, CodeValidation, "Items"},
+		{"valid status", "PATCH", "/orders/1", `{"status": "Ready"}`, http.StatusUnauthorized, CodeUnauthorized, ""},
+		{"unknown status", "PATCH", "/orders/1", `{"status": "Eaten"}`, http.StatusUnprocessableEntity, CodeValidation, "status"},
+		{"unknown order type filter", "GET", "/orders?type=drive-through", "", http.StatusUnprocessableEntity, CodeValidation, "type"},
+		{"not JSON", "POST", "/orders", `{"Items": `, http.StatusBadRequest, CodeBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var resp struct {
+				Error struct {
+					Code   string
+					Fields []FieldError
+				}
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("code %q, want %q", resp.Error.Code, tt.code)
+			}
+			if tt.field == "" {
+				return
+			}
+			for _, field := range resp.Error.Fields {
+				if field.Field == tt.field {
+					return
+				}
+			}
+			t.Errorf("fields %+v do not include %s", resp.Error.Fields, tt.field)
+		})
+	}
+}
+
+func TestStaleTokensAreRefused(t *testing.T) {
+	ctx := context.Background()
+	var err error
+	signer, err = auth.NewSigner(strings.Repeat("s", auth.MinSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := store.NewMemory([]store.Location{{ID: 1, Name: "Main"}, {ID: 2, Name: "Harbour"}}, nil, nil, nil)
+	repos = memory.Repositories()
+	r := setupRouter()
+
+	tests := []struct {
+		name   string
+		change func(*store.Staff)
+		status int
+	}{
+		{"unchanged", func(*store.Staff) {}, http.StatusOK},
+		{"deactivated", func(staff *store.Staff) { staff.Active = false }, http.StatusUnauthorized},
+		{"demoted", func(staff *store.Staff) { staff.Role = auth.RoleServer }, http.StatusUnauthorized},
+		{"moved", func(staff *store.Staff) { staff.LocationID = 2 }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staff, err := memory.CreateStaff(ctx, store.Staff{Username: tt.name, Name: "Sam", Role: auth.RoleManager, LocationID: 1, Active: true})
+			if err != nil {
+				t.Fatalf("CreateStaff: %v", err)
+			}
+			token, _, err := signer.Sign(auth.Claims{
+				Subject:  strconv.Itoa(staff.ID),
+				Username: staff.Username,
+				Name:     staff.Name,
+				Role:     staff.Role,
+				Location: staff.LocationID,
+			}, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(staff)
+			if _, err := memory.UpdateStaff(ctx, *staff); err != nil {
+				t.Fatalf("UpdateStaff: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/auth/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
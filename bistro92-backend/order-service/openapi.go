@@ -0,0 +1,57 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/common/openapi"
+)
+
+// openapiJSON is the API contract, served at /openapi.json. Requests are validated
+// against it before they reach the handlers.
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+var spec = openapi.MustNew(openapiJSON)
+
+func getOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", spec.JSON())
+}
+
+// validateRequest answers requests that do not match the OpenAPI document. Values that
+// cannot be read at all are bad requests, values that break the document's rules fail
+// validation.
+func validateRequest(c *gin.Context) {
+	err := spec.Validate(c.Request)
+	if err == nil {
+		c.Next()
+		return
+	}
+
+	var invalid *openapi.ValidationError
+	if !errors.As(err, &invalid) {
+		respondError(c, err)
+		return
+	}
+	if invalid.Malformed {
+		respondError(c, badRequest("The request could not be read", invalid.Fields...))
+		return
+	}
+	respondError(c, validationFailed("The request is invalid", invalid.Fields...))
+}
+
+// checkRoutes panics when the router and the OpenAPI document disagree, so that a
+// route cannot be added, moved or removed without updating the contract
+func checkRoutes(r *gin.Engine) {
+	var routes []openapi.Route
+	for _, route := range r.Routes() {
+		routes = append(routes, openapi.Route{Method: route.Method, Path: route.Path})
+	}
+	if err := spec.CheckRoutes(routes); err != nil {
+		panic(err)
+	}
+}
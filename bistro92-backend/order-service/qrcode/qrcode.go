@@ -0,0 +1,205 @@
+// Package qrcode encodes text as QR codes (ISO/IEC 18004) and renders them as PNG
+// images, e.g. for the codes printed on the tables. Text is encoded in byte mode with
+// error correction level M, in the smallest of versions 1 to 10 it fits.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// MaxLength is the most bytes a code holds, at version 10
+const MaxLength = 213
+
+// QuietZone is the light border, in modules, that scanners need around a code
+const QuietZone = 4
+
+var ErrTooLong = errors.New("qrcode: text is too long")
+
+// blockLayout is how a version's codewords are split into error correction blocks at
+// level M. Groups are {number of blocks, data codewords per block}.
+type blockLayout struct {
+	ecPerBlock int
+	groups     [][2]int
+}
+
+// layouts is indexed by version - 1
+var layouts = []blockLayout{
+	{10, [][2]int{{1, 16}}},
+	{16, [][2]int{{1, 28}}},
+	{26, [][2]int{{1, 44}}},
+	{18, [][2]int{{2, 32}}},
+	{24, [][2]int{{2, 43}}},
+	{16, [][2]int{{4, 27}}},
+	{18, [][2]int{{4, 31}}},
+	{22, [][2]int{{2, 38}, {2, 39}}},
+	{22, [][2]int{{3, 36}, {2, 37}}},
+	{26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+func (l blockLayout) dataCodewords() int {
+	n := 0
+	for _, group := range l.groups {
+		n += group[0] * group[1]
+	}
+	return n
+}
+
+// Code is an encoded QR code, a square of dark and light modules
+type Code struct {
+	Version int
+	Size    int // Modules per side, without the quiet zone
+	modules [][]bool
+}
+
+// Encode returns the QR code for the text
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= len(layouts); v++ {
+		if len(data) <= capacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := interleave(version, encodeData(version, data))
+	m := newMatrix(version)
+	m.drawFunctionPatterns()
+	m.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask) // XOR again to undo it
+	}
+	m.applyMask(best)
+	m.drawFormatBits(best)
+
+	return &Code{Version: version, Size: m.size, modules: m.modules}, nil
+}
+
+// Dark reports whether the module in column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// PNG renders the code with scale pixels per module, surrounded by the quiet zone
+func (c *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+QuietZone)*scale+dx, (y+QuietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countBits is the length of the byte count, which grows with the version
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// capacity is how many bytes a version holds
+func capacity(version int) int {
+	return (layouts[version-1].dataCodewords()*8 - 4 - countBits(version)) / 8
+}
+
+// encodeData returns the data codewords: the byte mode indicator, the count and the
+// bytes, padded to the version's number of data codewords
+func encodeData(version int, data []byte) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	total := layouts[version-1].dataCodewords() * 8
+	bits.append(0, min(4, total-len(bits))) // Terminator
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < total; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// interleave splits the data into blocks, adds each block's error correction and
+// returns the codewords in the order they are placed
+func interleave(version int, data []byte) []byte {
+	layout := layouts[version-1]
+	divisor := rsDivisor(layout.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	for _, group := range layout.groups {
+		for i := 0; i < group[0]; i++ {
+			block := data[:group[1]]
+			data = data[group[1]:]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	var result []byte
+	longest := layout.groups[len(layout.groups)-1][1]
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return result
+}
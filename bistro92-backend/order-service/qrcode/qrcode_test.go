@@ -0,0 +1,325 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// The vectors come from ISO/IEC 18004 and its worked examples
+
+func TestRSRemainder(t *testing.T) {
+	tests := []struct {
+		name     string
+		data, ec []byte
+	}{
+		{
+			"01234567, 1-M",
+			[]byte{0x10, 0x20, 0x0c, 0x56, 0x61, 0x80, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11},
+			[]byte{0xa5, 0x24, 0xd4, 0xc1, 0xed, 0x36, 0xc7, 0x87, 0x2c, 0x55},
+		},
+		{
+			"HELLO WORLD, 1-M",
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.ec))); !bytes.Equal(got, tt.ec) {
+			t.Errorf("%s: got % x, want % x", tt.name, got, tt.ec)
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	want := []int{
+		0b101010000010010,
+		0b101000100100101,
+		0b101111001111100,
+		0b101101101001011,
+		0b100010111111001,
+		0b100000011001110,
+		0b100111110010111,
+		0b100101010100000,
+	}
+	for mask, bits := range want {
+		if got := formatBits(mask); got != bits {
+			t.Errorf("mask %d: got %015b, want %015b", mask, got, bits)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	want := map[int]int{
+		7:  0b000111110010010100,
+		8:  0b001000010110111100,
+		9:  0b001001101010011001,
+		10: 0b001010010011010011,
+	}
+	for version, bits := range want {
+		if got := versionBits(version); got != bits {
+			t.Errorf("version %d: got %018b, want %018b", version, got, bits)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	want := [][]int{nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}}
+	for i, positions := range want {
+		got := alignmentPositions(i + 1)
+		if len(got) != len(positions) {
+			t.Errorf("version %d: got %v, want %v", i+1, got, positions)
+			continue
+		}
+		for j := range got {
+			if got[j] != positions[j] {
+				t.Errorf("version %d: got %v, want %v", i+1, got, positions)
+				break
+			}
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Bytes at level M
+	want := []int{14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+	for i, bytes := range want {
+		if got := capacity(i + 1); got != bytes {
+			t.Errorf("version %d: got %d, want %d", i+1, got, bytes)
+		}
+	}
+	if MaxLength != want[len(want)-1] {
+		t.Errorf("MaxLength is %d, want %d", MaxLength, want[len(want)-1])
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	code, err := Encode(strings.Repeat("a", MaxLength))
+	if err != nil {
+		t.Fatalf("%d bytes: %v", MaxLength, err)
+	}
+	if code.Version != 10 || code.Size != 57 {
+		t.Errorf("%d bytes: version %d, size %d, want version 10, size 57", MaxLength, code.Version, code.Size)
+	}
+
+	if _, err := Encode(strings.Repeat("a", MaxLength+1)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("%d bytes: got %v, want ErrTooLong", MaxLength+1, err)
+	}
+	// The limit is in bytes, not characters
+	if _, err := Encode(strings.Repeat("é", MaxLength/2+1)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("%d two-byte characters: got %v, want ErrTooLong", MaxLength/2+1, err)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+	}{
+		{"", 1},
+		{"HELLO WORLD", 1},
+		{strings.Repeat("a", 14), 1},
+		{strings.Repeat("a", 15), 2},
+		{"http://localhost:3000/order?t=eyJ0YWJsZSI6MywibG9jYXRpb24iOjF9.c2lnbmF0dXJl", 5},
+		{"Café Bistro 92 – table 4", 3},
+		{strings.Repeat("0123456789", 12) + "01", 7},
+		{strings.Repeat("a", 123), 8},
+		{strings.Repeat("a", MaxLength), 10},
+	}
+	for _, tt := range tests {
+		code, err := Encode(tt.text)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if code.Version != tt.version {
+			t.Errorf("%q: version %d, want %d", tt.text, code.Version, tt.version)
+		}
+		if got := decode(t, code); got != tt.text {
+			t.Errorf("decoded %q, want %q", got, tt.text)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("HELLO WORLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := (code.Size + 2*QuietZone) * 4
+	if bounds := img.Bounds(); bounds.Dx() != side || bounds.Dy() != side {
+		t.Fatalf("image is %v, want %dx%d", bounds, side, side)
+	}
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			r, _, _, _ := img.At((x+QuietZone)*4+1, (y+QuietZone)*4+1).RGBA()
+			if dark := r == 0; dark != code.Dark(x, y) {
+				t.Fatalf("pixel for module %d,%d is dark=%v, want %v", x, y, dark, code.Dark(x, y))
+			}
+		}
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("the quiet zone is dark")
+	}
+}
+
+// decode reads a code back the way a scanner does: it reads the format information,
+// removes the mask, collects the codewords, checks every block against its error
+// correction and returns the text
+func decode(t *testing.T, code *Code) string {
+	t.Helper()
+	size := code.Size
+
+	// The second copy of the format information, below the top right finder and to the
+	// right of the bottom left one
+	format := 0
+	for i := 0; i < 8; i++ {
+		if code.Dark(size-1-i, 8) {
+			format |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if code.Dark(8, size-15+i) {
+			format |= 1 << i
+		}
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(m) == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("version %d: format information %015b is not level M", code.Version, format)
+	}
+	if !code.Dark(8, size-8) {
+		t.Errorf("version %d: the dark module is light", code.Version)
+	}
+
+	m := newMatrix(code.Version)
+	m.drawFunctionPatterns()
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if m.isFunction[y][x] && !isFormatModule(x, y, size) && m.modules[y][x] != code.Dark(x, y) {
+				t.Fatalf("version %d: function module %d,%d is wrong", code.Version, x, y)
+			}
+			m.modules[y][x] = code.Dark(x, y)
+		}
+	}
+	m.applyMask(mask)
+
+	var codewords []byte
+	var bits bitBuffer
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if m.isFunction[y][x] {
+					continue
+				}
+				bit := 0
+				if m.modules[y][x] {
+					bit = 1
+				}
+				bits.append(bit, 1)
+			}
+		}
+	}
+	codewords = bits.bytes()
+
+	layout := layouts[code.Version-1]
+	var blocks [][]byte
+	for _, group := range layout.groups {
+		for i := 0; i < group[0]; i++ {
+			blocks = append(blocks, make([]byte, 0, group[1]+layout.ecPerBlock))
+		}
+	}
+	next := 0
+	longest := layout.groups[len(layout.groups)-1][1]
+	for i := 0; i < longest; i++ {
+		for b := range blocks {
+			if i < blockLength(layout, b) {
+				blocks[b] = append(blocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+
+	var data bitBuffer
+	for b, block := range blocks {
+		// A valid block evaluates to 0 at each root of the generator polynomial
+		root := byte(1)
+		for i := 0; i < layout.ecPerBlock; i++ {
+			var syndrome byte
+			for _, c := range block {
+				syndrome = gfMultiply(syndrome, root) ^ c
+			}
+			if syndrome != 0 {
+				t.Fatalf("version %d: block %d fails error correction check %d", code.Version, b, i)
+			}
+			root = gfMultiply(root, 0x02)
+		}
+		for _, c := range block[:len(block)-layout.ecPerBlock] {
+			data.append(int(c), 8)
+		}
+	}
+
+	read := func(n int) int {
+		value := 0
+		for _, bit := range data[:n] {
+			value <<= 1
+			if bit {
+				value |= 1
+			}
+		}
+		data = data[n:]
+		return value
+	}
+	if mode := read(4); mode != 0b0100 {
+		t.Fatalf("version %d: mode %04b, want byte mode", code.Version, mode)
+	}
+	text := make([]byte, read(countBits(code.Version)))
+	for i := range text {
+		text[i] = byte(read(8))
+	}
+	return string(text)
+}
+
+// isFormatModule reports whether the module holds format information, which
+// drawFunctionPatterns only reserves
+func isFormatModule(x, y, size int) bool {
+	return x == 8 && (y <= 8 || y >= size-8) || y == 8 && (x <= 8 || x >= size-8)
+}
+
+func blockLength(layout blockLayout, block int) int {
+	for _, group := range layout.groups {
+		if block < group[0] {
+			return group[1]
+		}
+		block -= group[0]
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package receipt
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"rate": formatRate,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.Receipt.Number}}</title>
+<style>
+  body { font-family: monospace; width: 80mm; margin: 0 auto; }
+  h1 { font-size: 1.4em; margin-bottom: 0; }
+  header, footer { text-align: center; }
+  table { width: 100%; border-collapse: collapse; }
+  td.amount { text-align: right; }
+  tr.total td { font-weight: bold; border-top: 1px dashed #000; }
+  hr { border: 0; border-top: 1px dashed #000; }
+  @media print { body { width: auto; } }
+</style>
+</head>
+<body>
+<header>
+  <h1>{{.Header.Name}}</h1>
+  {{with .Header.Address}}<div>{{.}}</div>{{end}}
+  {{with .Header.Phone}}<div>Tel: {{.}}</div>{{end}}
+</header>
+<hr>
+<table>
+  <tr><td>Receipt</td><td class="amount">{{.Receipt.Number}}</td></tr>
+  {{if .Receipt.TableNumber}}
+  <tr><td>Table</td><td class="amount">{{.Receipt.TableNumber}}</td></tr>
+  {{else}}
+  <tr><td>{{.Receipt.TypeLabel}}</td><td class="amount">{{.Receipt.Customer}}</td></tr>
+  {{end}}
+  <tr><td>Orders</td><td class="amount">{{range $i, $id := .Receipt.OrderIDs}}{{if $i}}, {{end}}#{{$id}}{{end}}</td></tr>
+  <tr><td>Date</td><td class="amount">{{.Receipt.IssuedAt.Format "2006-01-02 15:04"}}</td></tr>
+</table>
+<hr>
+<table>
+  {{range .Receipt.Lines}}
+  <tr><td>{{.Quantity}}x {{.Name}}{{if gt .Quantity 1}} @ {{.UnitPrice.Decimal}}{{end}}</td><td class="amount">{{.Amount.Decimal}}</td></tr>
+  {{end}}
+</table>
+<hr>
+<table>
+  <tr><td>Subtotal</td><td class="amount">{{.Receipt.Subtotal.Decimal}}</td></tr>
+  {{range .Receipt.Tax}}
+  <tr><td>{{.Name}} {{rate .Rate}}%{{if .Inclusive}} (incl.){{end}}</td><td class="amount">{{.Tax.Decimal}}</td></tr>
+  {{end}}
+  {{if not .Receipt.Discount.IsZero}}
+  <tr><td>Loyalty discount</td><td class="amount">-{{.Receipt.Discount.Decimal}}</td></tr>
+  {{end}}
+  <tr class="total"><td>TOTAL {{.Receipt.Total.Currency}}</td><td class="amount">{{.Receipt.Total.Decimal}}</td></tr>
+</table>
+<footer><p>Thank you for dining with us!</p></footer>
+</body>
+</html>
+`))
+
+// RenderHTML renders the receipt as a standalone page sized for printing.
+func RenderHTML(h Header, r Receipt) ([]byte, error) {
+	var buf bytes.Buffer
+	err := htmlTemplate.Execute(&buf, struct {
+		Header  Header
+		Receipt Receipt
+	}{h, r})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
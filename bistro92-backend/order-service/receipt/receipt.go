@@ -0,0 +1,144 @@
+// Package receipt renders guest receipts for one or more orders as plain text,
+// printable HTML or raw ESC/POS bytes.
+package receipt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bistro92/backend/common/money"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// Output formats accepted by Render
+const (
+	FormatText   = "text"
+	FormatHTML   = "html"
+	FormatESCPOS = "escpos"
+)
+
+// Header is the restaurant information printed at the top of every receipt
+type Header struct {
+	Name    string
+	Address string
+	Phone   string
+}
+
+// Line is one item line on the receipt
+type Line struct {
+	Name      string
+	Quantity  int
+	UnitPrice money.Money
+	Amount    money.Money
+}
+
+// Receipt is everything needed to print a receipt, independent of the output format
+type Receipt struct {
+	Number      string
+	IssuedAt    time.Time
+	TableNumber int // 0 for takeaway and delivery orders, which name the customer instead
+	OrderType   string
+	Customer    string
+	OrderIDs    []int
+	Lines       []Line
+	Subtotal    money.Money
+	Tax         []store.TaxLine
+	// Discount is what redeemed loyalty points took off the total
+	Discount money.Money
+	Total    money.Money
+}
+
+// New builds a receipt covering the given orders, which must all belong to the same table.
+func New(orders []store.Order, issuedAt time.Time) (Receipt, error) {
+	if len(orders) == 0 {
+		return Receipt{}, fmt.Errorf("no orders to print a receipt for")
+	}
+
+	r := Receipt{
+		IssuedAt:    issuedAt,
+		TableNumber: orders[0].TableNumber,
+		OrderType:   orders[0].Type,
+		Customer:    orders[0].CustomerName,
+	}
+
+	taxByCategory := make(map[string]*store.TaxLine)
+	for _, order := range orders {
+		r.OrderIDs = append(r.OrderIDs, order.ID)
+		for _, item := range order.Items {
+			amount := item.Price.Mul(item.Quantity)
+			r.Lines = append(r.Lines, Line{
+				Name:      item.Name,
+				Quantity:  item.Quantity,
+				UnitPrice: item.Price,
+				Amount:    amount,
+			})
+			r.Subtotal = r.Subtotal.Add(amount)
+		}
+
+		for _, tax := range order.TaxBreakdown {
+			line, ok := taxByCategory[tax.Category]
+			if !ok {
+				line = &store.TaxLine{
+					Category:  tax.Category,
+					Name:      tax.Name,
+					Rate:      tax.Rate,
+					Inclusive: tax.Inclusive,
+				}
+				taxByCategory[tax.Category] = line
+			}
+			line.Taxable = line.Taxable.Add(tax.Taxable)
+			line.Tax = line.Tax.Add(tax.Tax)
+		}
+
+		r.Discount = r.Discount.Add(order.Discount)
+		r.Total = r.Total.Add(order.TotalAmount)
+	}
+
+	for _, line := range taxByCategory {
+		r.Tax = append(r.Tax, *line)
+	}
+	sort.Slice(r.Tax, func(i, j int) bool { return r.Tax[i].Category < r.Tax[j].Category })
+	sort.Ints(r.OrderIDs)
+
+	r.Number = number(orders[0].OrderTime, r.TableNumber, r.OrderIDs)
+	return r, nil
+}
+
+// TypeLabel names the order type for the receipt, e.g. "Takeaway"
+func (r Receipt) TypeLabel() string {
+	switch r.OrderType {
+	case store.OrderTakeaway:
+		return "Takeaway"
+	case store.OrderDelivery:
+		return "Delivery"
+	}
+	return "Dine-in"
+}
+
+// Render renders the receipt in the requested format and returns the body together
+// with its content type.
+func Render(format string, h Header, r Receipt) ([]byte, string, error) {
+	switch format {
+	case "", FormatText:
+		return RenderText(h, r), "text/plain; charset=utf-8", nil
+	case FormatHTML:
+		body, err := RenderHTML(h, r)
+		return body, "text/html; charset=utf-8", err
+	case FormatESCPOS:
+		return RenderESCPOS(h, r), "application/octet-stream", nil
+	default:
+		return nil, "", fmt.Errorf("unknown receipt format %q", format)
+	}
+}
+
+// number derives a stable receipt number from the orders it covers, so that reprinting
+// the same receipt gives the same number. Single orders get R-<date>-<order>, table
+// receipts also carry the table and the range of orders.
+func number(orderTime time.Time, tableNumber int, orderIDs []int) string {
+	date := orderTime.Format("20060102")
+	if len(orderIDs) == 1 {
+		return fmt.Sprintf("R-%s-%06d", date, orderIDs[0])
+	}
+	return fmt.Sprintf("R-%s-T%02d-%06d-%06d", date, tableNumber, orderIDs[0], orderIDs[len(orderIDs)-1])
+}
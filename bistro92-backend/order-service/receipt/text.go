@@ -0,0 +1,159 @@
+package receipt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bistro92/backend/order-service/escpos"
+)
+
+// Width is the number of characters per line on an 80mm printer using font A
+const Width = 42
+
+// RenderText renders the receipt as fixed-width plain text.
+func RenderText(h Header, r Receipt) []byte {
+	var sb strings.Builder
+	for _, line := range headerLines(h) {
+		sb.WriteString(center(line))
+		sb.WriteByte('\n')
+	}
+	for _, line := range bodyLines(r) {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String())
+}
+
+// RenderESCPOS renders the receipt as a raw ESC/POS job, ending with a paper cut.
+func RenderESCPOS(h Header, r Receipt) []byte {
+	b := escpos.New()
+
+	b.Align(escpos.AlignCenter).Bold(true).Size(2, 2).Line(h.Name).Size(1, 1).Bold(false)
+	for _, line := range headerLines(h)[1:] {
+		b.Line(line)
+	}
+
+	b.Align(escpos.AlignLeft)
+	for _, line := range bodyLines(r) {
+		b.Line(line)
+	}
+
+	return b.Feed(3).Cut().Bytes()
+}
+
+func headerLines(h Header) []string {
+	lines := []string{h.Name}
+	if h.Address != "" {
+		lines = append(lines, h.Address)
+	}
+	if h.Phone != "" {
+		lines = append(lines, "Tel: "+h.Phone)
+	}
+	return lines
+}
+
+// served is the line saying who the receipt is for: the table, or the customer of a
+// takeaway or delivery order
+func served(r Receipt) string {
+	if r.TableNumber == 0 {
+		return columns(r.TypeLabel(), r.Customer)
+	}
+	return columns("Table", fmt.Sprintf("%d", r.TableNumber))
+}
+
+func bodyLines(r Receipt) []string {
+	rule := strings.Repeat("-", Width)
+	lines := []string{
+		rule,
+		columns("Receipt", r.Number),
+		served(r),
+	}
+	lines = append(lines, wrapped("Orders", orderIDs(r.OrderIDs))...)
+	lines = append(lines,
+		columns("Date", r.IssuedAt.Format("2006-01-02 15:04")),
+		rule,
+	)
+
+	for _, line := range r.Lines {
+		lines = append(lines, columns(fmt.Sprintf("%dx %s", line.Quantity, line.Name), line.Amount.Decimal()))
+		if line.Quantity > 1 {
+			lines = append(lines, fmt.Sprintf("   @ %s", line.UnitPrice.Decimal()))
+		}
+	}
+
+	lines = append(lines, rule, columns("Subtotal", r.Subtotal.Decimal()))
+	for _, tax := range r.Tax {
+		label := fmt.Sprintf("%s %s%%", tax.Name, formatRate(tax.Rate))
+		if tax.Inclusive {
+			label += " (incl.)"
+		}
+		lines = append(lines, columns(label, tax.Tax.Decimal()))
+	}
+	if !r.Discount.IsZero() {
+		lines = append(lines, columns("Loyalty discount", "-"+r.Discount.Decimal()))
+	}
+	lines = append(lines,
+		rule,
+		columns("TOTAL "+r.Total.Currency, r.Total.Decimal()),
+		rule,
+		center("Thank you for dining with us!"),
+	)
+
+	return lines
+}
+
+// columns lays out a label on the left and a value on the right of one line, cutting
+// the label short when both do not fit. Widths are counted in characters, not bytes.
+func columns(left, right string) string {
+	space := Width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if space < 1 {
+		runes := []rune(left)
+		left = string(runes[:max(0, len(runes)+space-1)])
+		space = 1
+	}
+	return left + strings.Repeat(" ", space) + right
+}
+
+// wrapped lays out a label and a list of values like columns, continuing the values on
+// right-aligned lines of their own when they do not fit on one
+func wrapped(label string, values []string) []string {
+	room := Width - utf8.RuneCountInString(label) - 1
+	var lines []string
+	line := ""
+	for i, value := range values {
+		if i < len(values)-1 {
+			value += ","
+		}
+		switch {
+		case line == "":
+			line = value
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(value) <= room:
+			line += " " + value
+		default:
+			lines = append(lines, columns(label, line))
+			label, line = "", value
+		}
+	}
+	return append(lines, columns(label, line))
+}
+
+func center(text string) string {
+	length := utf8.RuneCountInString(text)
+	if length >= Width {
+		return text
+	}
+	return strings.Repeat(" ", (Width-length)/2) + text
+}
+
+func formatRate(rate float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", rate*100), "0"), ".")
+}
+
+func orderIDs(ids []int) []string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("#%d", id)
+	}
+	return parts
+}
@@ -0,0 +1,113 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+func testReceipt() Receipt {
+	usd := func(amount int64) money.Money { return money.New(amount, money.DefaultCurrency) }
+	return Receipt{
+		Number:      "20261018-T3-41",
+		IssuedAt:    time.Date(2026, 10, 18, 20, 15, 0, 0, time.UTC),
+		TableNumber: 3,
+		OrderIDs:    []int{41},
+		Lines: []Line{
+			{Name: "Crème brûlée façon grand-mère à l'ancienne", Quantity: 2, UnitPrice: usd(650), Amount: usd(1300)},
+			{Name: "Smørrebrød", Quantity: 1, UnitPrice: usd(1199), Amount: usd(1199)},
+		},
+		Subtotal: usd(2499),
+		Total:    usd(2499),
+	}
+}
+
+// checkLines fails for lines that are not valid UTF-8 or run past Width
+func checkLines(t *testing.T, text string) []string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for _, line := range lines {
+		if !utf8.ValidString(line) {
+			t.Errorf("line %q is not valid UTF-8", line)
+		}
+		if n := utf8.RuneCountInString(line); n > Width {
+			t.Errorf("line %q is %d characters wide, more than %d", line, n, Width)
+		}
+	}
+	return lines
+}
+
+func TestRenderTextNonASCII(t *testing.T) {
+	lines := checkLines(t, string(RenderText(Header{Name: "Bistro-92 Café"}, testReceipt())))
+
+	want := map[string]bool{
+		// Cut short by characters, keeping the amount
+		"2x Crème brûlée façon grand-mère à l 13.00": false,
+		"1x Smørrebrød                        11.99": false,
+	}
+	for _, line := range lines {
+		if _, ok := want[line]; ok {
+			want[line] = true
+		}
+	}
+	for line, found := range want {
+		if !found {
+			t.Errorf("no line %q in:\n%s", line, strings.Join(lines, "\n"))
+		}
+	}
+	if center := lines[0]; strings.TrimSpace(center) != "Bistro-92 Café" || len(center)-len(strings.TrimLeft(center, " ")) != 14 {
+		t.Errorf("header %q is not centred", center)
+	}
+}
+
+func TestRenderTextWrapsOrderIDs(t *testing.T) {
+	r := testReceipt()
+	r.OrderIDs = nil
+	for id := 1001; id <= 1012; id++ {
+		r.OrderIDs = append(r.OrderIDs, id)
+	}
+	lines := checkLines(t, string(RenderText(Header{Name: "Bistro-92"}, r)))
+
+	var ids []string
+	wrapped := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "Orders") {
+			continue
+		}
+		ids = strings.Fields(strings.TrimPrefix(line, "Orders"))
+		for _, next := range lines[i+1:] {
+			if !strings.HasPrefix(next, " ") {
+				break
+			}
+			if !strings.HasSuffix(next, ",") && !strings.HasSuffix(next, "#1012") {
+				t.Errorf("continuation %q is not right-aligned", next)
+			}
+			ids = append(ids, strings.Fields(next)...)
+			wrapped++
+		}
+	}
+	if wrapped == 0 {
+		t.Errorf("12 order IDs were not wrapped:\n%s", strings.Join(lines, "\n"))
+	}
+	if got := strings.Join(ids, " "); got != "#1001, #1002, #1003, #1004, #1005, #1006, #1007, #1008, #1009, #1010, #1011, #1012" {
+		t.Errorf("order IDs read %q", got)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		left, right, want string
+	}{
+		{"Subtotal", "24.99", "Subtotal                             24.99"},
+		{strings.Repeat("é", 50), "1.00", strings.Repeat("é", 37) + " 1.00"},
+		{"", strings.Repeat("9", 45), " " + strings.Repeat("9", 45)},
+	}
+	for _, tt := range tests {
+		if got := columns(tt.left, tt.right); got != tt.want {
+			t.Errorf("columns(%q, %q) = %q, want %q", tt.left, tt.right, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// shiftRangeDays is how far GET /shifts looks ahead when no to is given
+const shiftRangeDays = 7
+
+// Shift handlers
+// getShifts lists the shifts at the location that overlap from/to, by default the week
+// from the start of today. from/to take RFC 3339 times or plain dates, to being
+// inclusive of the whole day; staff_id limits the list to one staff member.
+func getShifts(c *gin.Context) {
+	ctx := context.Background()
+	y, m, d := time.Now().Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, _, err = parseTimeOrDate(value); err != nil {
+			respondError(c, invalidParam("from", "from must be an RFC 3339 time or a YYYY-MM-DD date"))
+			return
+		}
+	}
+	to := from.AddDate(0, 0, shiftRangeDays)
+	if value := c.Query("to"); value != "" {
+		t, isDate, err := parseTimeOrDate(value)
+		if err != nil {
+			respondError(c, invalidParam("to", "to must be an RFC 3339 time or a YYYY-MM-DD date"))
+			return
+		}
+		if isDate {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	staffID, err := queryInt(c, "staff_id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	shifts, err := repos.Shifts.ListShifts(ctx, locationFrom(c), from, to, staffID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, shifts)
+}
+
+// createShift schedules a shift at the location the request works at. Without a
+// section the staff member works the whole floor.
+func createShift(c *gin.Context) {
+	ctx := context.Background()
+	var req struct {
+		StaffID int       `json:"staff_id" binding:"required,min=1"`
+		Section string    `json:"section" binding:"max=30"`
+		Start   time.Time `json:"start" binding:"required"`
+		End     time.Time `json:"end" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	shift, err := repos.Shifts.ScheduleShift(ctx, store.Shift{
+		StaffID:        req.StaffID,
+		LocationID:     locationFrom(c),
+		Section:        req.Section,
+		ScheduledStart: &req.Start,
+		ScheduledEnd:   &req.End,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, shift)
+}
+
+// deleteShift removes a scheduled shift that has not been clocked into
+func deleteShift(c *gin.Context) {
+	ctx := context.Background()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, invalidParam("id", "Invalid shift ID"))
+		return
+	}
+	shift, err := repos.Shifts.GetShift(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if shift.LocationID != locationFrom(c) {
+		respondError(c, notFound(fmt.Sprintf("shift %d not found", id)))
+		return
+	}
+
+	if err := repos.Shifts.DeleteShift(ctx, id); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shift deleted successfully"})
+}
+
+// Clock handlers; they act on the logged in staff member's own shift
+// getClock returns the shift the staff member is clocked into
+func getClock(c *gin.Context) {
+	clock(c, repos.Shifts.CurrentShift)
+}
+
+// clockIn starts the staff member's shift at the location the request works at: the
+// scheduled shift starting within the next hour or already under way, otherwise an
+// unscheduled one. A section in the body replaces the scheduled one.
+func clockIn(c *gin.Context) {
+	ctx := context.Background()
+	staffID, err := staffIDFrom(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var req struct {
+		Section string `json:"section" binding:"max=30"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, bindError(err))
+			return
+		}
+	}
+
+	shift, err := repos.Shifts.ClockIn(ctx, staffID, locationFrom(c), req.Section)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// clockOut ends the staff member's shift, and the break they are on
+func clockOut(c *gin.Context) {
+	clock(c, repos.Shifts.ClockOut)
+}
+
+func startBreak(c *gin.Context) {
+	clock(c, repos.Shifts.StartBreak)
+}
+
+func endBreak(c *gin.Context) {
+	clock(c, repos.Shifts.EndBreak)
+}
+
+// clock answers a clock request with the staff member's shift after the change
+func clock(c *gin.Context, change func(ctx context.Context, staffID int) (*store.Shift, error)) {
+	staffID, err := staffIDFrom(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	shift, err := change(context.Background(), staffID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
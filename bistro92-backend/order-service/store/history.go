@@ -0,0 +1,109 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Order event types, one per kind of change recorded in an order's history
+const (
+	EventCreated       = "created"
+	EventAmended       = "amended"
+	EventStatusChanged = "status_changed"
+	EventCancelled     = "cancelled"
+	EventPaid          = "paid"
+	EventDeleted       = "deleted"
+	EventRestored      = "restored"
+	EventAssigned      = "assigned"
+)
+
+// SystemActor is recorded for changes that no staff member or device asked for
+const SystemActor = "system"
+
+// OrderEvent is one entry of an order's append-only history
+type OrderEvent struct {
+	ID         int64
+	OrderID    int
+	Type       string
+	Actor      string
+	OccurredAt time.Time
+	Previous   json.RawMessage `json:",omitempty"`
+	Current    json.RawMessage `json:",omitempty"`
+}
+
+// StatusDuration is a period the order spent in one status. Periods that are still
+// running end now; terminal statuses have no duration.
+type StatusDuration struct {
+	Status          string
+	EnteredAt       time.Time
+	LeftAt          *time.Time `json:",omitempty"`
+	DurationSeconds *float64   `json:",omitempty"`
+}
+
+type OrderHistory struct {
+	OrderID    int
+	LocationID int
+	Events     []OrderEvent
+	Statuses []StatusDuration
+	// Total time spent in each status, in seconds, summed over repeated visits
+	TimeInStatus map[string]float64
+}
+
+// newHistory builds the history of an order from its events
+func newHistory(orderID, location int, orderTime time.Time, events []OrderEvent, now time.Time) *OrderHistory {
+	history := &OrderHistory{OrderID: orderID, LocationID: location, Events: events}
+	if history.Events == nil {
+		history.Events = []OrderEvent{}
+	}
+
+	history.Statuses = statusDurations(orderTime, events, now)
+	history.TimeInStatus = make(map[string]float64)
+	for _, period := range history.Statuses {
+		if period.DurationSeconds != nil {
+			history.TimeInStatus[period.Status] += *period.DurationSeconds
+		}
+	}
+	return history
+}
+
+// statusDurations derives the status periods from the events. Orders created before
+// the event log existed have no created event and are assumed Pending from order_time.
+// Statuses are read from the "Status" key of each event's current values.
+func statusDurations(orderTime time.Time, events []OrderEvent, now time.Time) []StatusDuration {
+	var periods []StatusDuration
+	enter := func(status string, at time.Time) {
+		if n := len(periods); n > 0 {
+			if periods[n-1].Status == status {
+				return
+			}
+			left := at
+			seconds := at.Sub(periods[n-1].EnteredAt).Seconds()
+			periods[n-1].LeftAt = &left
+			periods[n-1].DurationSeconds = &seconds
+		}
+		periods = append(periods, StatusDuration{Status: status, EnteredAt: at})
+	}
+
+	if len(events) == 0 || events[0].Type != EventCreated {
+		enter("Pending", orderTime)
+	}
+
+	for _, event := range events {
+		var current struct{ Status string }
+		if len(event.Current) > 0 {
+			json.Unmarshal(event.Current, &current)
+		}
+		if current.Status != "" {
+			enter(current.Status, event.OccurredAt)
+		}
+	}
+
+	if n := len(periods); n > 0 {
+		if last := periods[n-1].Status; !Closed(last) {
+			seconds := now.Sub(periods[n-1].EnteredAt).Seconds()
+			periods[n-1].DurationSeconds = &seconds
+		}
+	}
+
+	return periods
+}
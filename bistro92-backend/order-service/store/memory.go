@@ -0,0 +1,1479 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/common/money"
+)
+
+// Memory implements the repositories in process. It behaves like Postgres, including
+// the order history and the events written to the outbox, but keeps nothing once the
+// process exits. The ref passed to CreateOrder is only kept as the order's WorkflowID.
+type Memory struct {
+	mu          sync.Mutex
+	locations   map[int]Location
+	menu        map[int]MenuItem
+	rates       map[taxKey]TaxRate
+	tables      map[tableKey]Table
+	orders      map[int]*memoryOrder
+	payments    []Payment
+	staff       map[int]Staff
+	devices     map[string]Device
+	shifts      map[int]*Shift
+	customers   map[int]Customer
+	loyalty     []LoyaltyTransaction
+	outbox      []events.Envelope
+	lastID      int
+	lastEvID    int64
+	lastShiftID int
+}
+
+// tableKey identifies a table; numbers are only unique within a location
+type tableKey struct {
+	location, number int
+}
+
+type memoryOrder struct {
+	Order
+	stockRestored bool
+	events        []OrderEvent
+}
+
+func NewMemory(locations []Location, menu []MenuItem, rates []TaxRate, tables []Table) *Memory {
+	m := &Memory{
+		locations: make(map[int]Location),
+		menu:      make(map[int]MenuItem),
+		rates:     make(map[taxKey]TaxRate),
+		tables:    make(map[tableKey]Table),
+		orders:    make(map[int]*memoryOrder),
+		staff:     make(map[int]Staff),
+		devices:   make(map[string]Device),
+		shifts:    make(map[int]*Shift),
+		customers: make(map[int]Customer),
+	}
+	for _, location := range locations {
+		m.locations[location.ID] = location
+	}
+	for _, item := range menu {
+		m.menu[item.ID] = copyMenuItem(item)
+	}
+	for _, rate := range rates {
+		m.rates[taxKey{rate.Category, rate.OrderType}] = rate
+	}
+	for _, table := range tables {
+		if table.CodeVersion == 0 {
+			table.CodeVersion = 1
+		}
+		m.tables[tableKey{table.LocationID, table.Number}] = table
+	}
+	return m
+}
+
+// Repositories returns m as each of the repositories
+func (m *Memory) Repositories() Repositories {
+	return Repositories{Locations: m, Menu: m, Tables: m, Orders: m, Payments: m, Staff: m, Devices: m, Shifts: m, Customers: m}
+}
+
+// Outbox returns the events written so far, oldest first
+func (m *Memory) Outbox() []events.Envelope {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]events.Envelope(nil), m.outbox...)
+}
+
+func (m *Memory) ListLocations(ctx context.Context) ([]Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	locations := make([]Location, 0, len(m.locations))
+	for _, location := range m.locations {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID < locations[j].ID })
+	return locations, nil
+}
+
+func (m *Memory) GetLocation(ctx context.Context, id int) (*Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	location, ok := m.locations[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "location %d not found", id)
+	}
+	return &location, nil
+}
+
+func (m *Memory) CreateLocation(ctx context.Context, location Location) (*Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	location.ID = len(m.locations) + 1
+	location.CreatedAt = time.Now()
+	m.locations[location.ID] = location
+	return &location, nil
+}
+
+func (m *Memory) ListMenuItems(ctx context.Context, location int) ([]MenuItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := []MenuItem{}
+	for _, item := range m.menu {
+		if item.LocationID == location {
+			items = append(items, copyMenuItem(item))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func (m *Memory) GetMenuItem(ctx context.Context, location, id int) (*MenuItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.menu[id]
+	if !ok || item.LocationID != location {
+		return nil, errorf(ErrNotFound, "menu item %d not found", id)
+	}
+	item = copyMenuItem(item)
+	return &item, nil
+}
+
+func (m *Memory) MenuItemsByID(ctx context.Context, location int, ids []int) (map[int]MenuItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byID := make(map[int]MenuItem, len(ids))
+	for _, id := range ids {
+		if item, ok := m.menu[id]; ok && item.LocationID == location {
+			byID[id] = copyMenuItem(item)
+		}
+	}
+	return byID, nil
+}
+
+func (m *Memory) ListTables(ctx context.Context, location int) ([]Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tables := []Table{}
+	for _, table := range m.tables {
+		if table.LocationID == location {
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Number < tables[j].Number })
+	return tables, nil
+}
+
+func (m *Memory) GetTable(ctx context.Context, location, number int) (*Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, ok := m.tables[tableKey{location, number}]
+	if !ok {
+		return nil, errorf(ErrNotFound, "table %d not found", number)
+	}
+	return &table, nil
+}
+
+func (m *Memory) RotateTableCode(ctx context.Context, location, number int) (*Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := tableKey{location, number}
+	table, ok := m.tables[key]
+	if !ok {
+		return nil, errorf(ErrNotFound, "table %d not found", number)
+	}
+	table.CodeVersion++
+	m.tables[key] = table
+	return &table, nil
+}
+
+func (m *Memory) ReleaseTableIfLastOpen(ctx context.Context, orderID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderID]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := m.tables[tableKey{order.LocationID, order.TableNumber}]; !ok {
+		return false, nil
+	}
+	for _, other := range m.orders {
+		if other.LocationID == order.LocationID && other.TableNumber == order.TableNumber && other.ID != orderID &&
+			!Closed(other.Status) && other.DeletedAt == nil {
+			return false, nil
+		}
+	}
+
+	m.setTableStatus(order.LocationID, order.TableNumber, "Available")
+	return true, nil
+}
+
+func (m *Memory) CreateOrder(ctx context.Context, order Order, actor, ref string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.locations[order.LocationID]; !ok {
+		return 0, errorf(ErrNotFound, "location %d not found", order.LocationID)
+	}
+	items, err := m.menuLines(order.LocationID, order.Items)
+	if err != nil {
+		return 0, err
+	}
+	order.Items = items
+	totals := m.price(order.LocationID, order.Type, order.Items)
+	points, discount, err := m.checkRedemption(order.CustomerID, order.PointsRedeemed, totals.Total)
+	if err != nil {
+		return 0, err
+	}
+	order.PointsRedeemed = points
+	if order.Type == "" {
+		order.Type = OrderDineIn
+	}
+
+	if order.TableNumber != 0 {
+		m.setTableStatus(order.LocationID, order.TableNumber, "Occupied")
+	}
+	m.adjustStock(order.LocationID, order.Items, -1)
+	chefID, chefName := m.chooseChef(order.LocationID, order.Items)
+	handlerID, handlerName := m.handlerFor(order.LocationID, order.TableNumber, order.HandledByID)
+
+	m.lastID++
+	stored := &memoryOrder{Order: Order{
+		ID:              m.lastID,
+		LocationID:      order.LocationID,
+		Type:            order.Type,
+		TableNumber:     order.TableNumber,
+		Items:           append([]OrderItem(nil), order.Items...),
+		Status:          "Pending",
+		AssignedToID:    chefID,
+		AssignedTo:      chefName,
+		HandledByID:     handlerID,
+		HandledBy:       handlerName,
+		CustomerID:      order.CustomerID,
+		PointsRedeemed:  order.PointsRedeemed,
+		Discount:        discount,
+		WorkflowID:      ref,
+		CustomerName:    order.CustomerName,
+		CustomerPhone:   order.CustomerPhone,
+		PickupTime:      order.PickupTime,
+		DeliveryAddress: order.DeliveryAddress,
+		OrderTime:       now(),
+		TotalAmount:     totals.Total.Sub(discount),
+		TaxAmount:       totals.TaxAmount,
+		TaxBreakdown:    totals.TaxBreakdown,
+		Notes:           order.Notes,
+		Version:         1,
+	}}
+	m.orders[stored.ID] = stored
+	if order.PointsRedeemed > 0 {
+		m.changePoints(order.CustomerID, stored.ID, PointsRedeemed, -order.PointsRedeemed)
+	}
+
+	m.recordEvent(stored, EventCreated, actor, nil, map[string]interface{}{
+		"Status":         "Pending",
+		"Type":           order.Type,
+		"TableNumber":    order.TableNumber,
+		"CustomerName":   order.CustomerName,
+		"PickupTime":     order.PickupTime,
+		"Items":          order.Items,
+		"TotalAmount":    stored.TotalAmount,
+		"Notes":          order.Notes,
+		"HandledBy":      handlerName,
+		"CustomerID":     order.CustomerID,
+		"PointsRedeemed": order.PointsRedeemed,
+	})
+	if chefID != 0 {
+		m.recordEvent(stored, EventAssigned, SystemActor, nil, assignment(chefID, chefName))
+	}
+	m.enqueue(order.LocationID, events.OrderCreated, orderPayload(&stored.Order))
+	if order.TableNumber != 0 {
+		m.enqueue(order.LocationID, events.TableUpdated, events.Table{Number: order.TableNumber, Status: "Occupied"})
+	}
+
+	return stored.ID, nil
+}
+
+func (m *Memory) GetOrder(ctx context.Context, id int) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	return copyOrder(order.Order), nil
+}
+
+func (m *Memory) ListOrders(ctx context.Context, q OrderQuery) (*OrderPage, error) {
+	q.normalize()
+
+	key := strings.TrimPrefix(q.Sort, "-")
+	if !sortKeys[key] {
+		return nil, errorf(ErrInvalid, "unknown sort %q", q.Sort)
+	}
+	descending := strings.HasPrefix(q.Sort, "-")
+	before := func(a, b Order) bool {
+		c := compareOrders(key, a, b)
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	var after *Order
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != q.Sort {
+			return nil, errorf(ErrInvalid, "invalid cursor")
+		}
+		after, err = cursorOrder(key, c)
+		if err != nil {
+			return nil, errorf(ErrInvalid, "invalid cursor")
+		}
+	}
+
+	m.mu.Lock()
+	var orders []Order
+	for _, order := range m.orders {
+		if matches(q, order.Order) && (after == nil || before(*after, order.Order)) {
+			orders = append(orders, *copyOrder(order.Order))
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(orders, func(i, j int) bool { return before(orders[i], orders[j]) })
+
+	page := &OrderPage{Orders: []Order{}}
+	if len(orders) > q.Limit {
+		last := orders[q.Limit-1]
+		page.NextCursor = encodeCursor(cursor{Sort: q.Sort, Value: sortValue(key, last), ID: last.ID})
+		orders = orders[:q.Limit]
+	}
+	page.Orders = append(page.Orders, orders...)
+
+	return page, nil
+}
+
+func (m *Memory) OpenTableOrders(ctx context.Context, location, tableNumber int) ([]Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orders := []Order{}
+	for _, order := range m.orders {
+		if order.LocationID == location && order.TableNumber == tableNumber && !Closed(order.Status) && order.DeletedAt == nil {
+			orders = append(orders, *copyOrder(order.Order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return compareOrders("order_time", orders[i], orders[j]) < 0 })
+	return orders, nil
+}
+
+func (m *Memory) AmendOrder(ctx context.Context, id int, items []OrderItem, notes, actor string) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if Closed(order.Status) {
+		return nil, errorf(ErrOrderClosed, "order %d is %s and can no longer be amended", id, order.Status)
+	}
+
+	items, err = m.menuLines(order.LocationID, items)
+	if err != nil {
+		return nil, err
+	}
+	previousTotal, previousNotes := order.TotalAmount, order.Notes
+
+	order.Items = append(append([]OrderItem(nil), order.Items...), items...)
+	totals := m.price(order.LocationID, order.Type, order.Items)
+	m.adjustStock(order.LocationID, items, -1)
+
+	order.TotalAmount = totals.Total.Sub(order.Discount)
+	order.TaxAmount = totals.TaxAmount
+	order.TaxBreakdown = totals.TaxBreakdown
+	order.Notes = appendNotes(previousNotes, notes)
+	order.Version++
+
+	m.recordEvent(order, EventAmended, actor,
+		map[string]interface{}{"TotalAmount": previousTotal, "Notes": previousNotes},
+		map[string]interface{}{"TotalAmount": order.TotalAmount, "Notes": order.Notes, "AddedItems": items},
+	)
+	m.enqueue(order.LocationID, events.OrderAmended, orderPayload(&order.Order))
+
+	return copyOrder(order.Order), nil
+}
+
+func (m *Memory) UpdateStatus(ctx context.Context, id int, status string, chefID, expectedVersion int, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(id, expectedVersion, order.Version); err != nil {
+		return err
+	}
+	if Closed(order.Status) {
+		return errorf(ErrOrderClosed, "order %d is %s and its status can no longer be changed", id, order.Status)
+	}
+	if err := checkStatus(order.Type, order.Status, status); err != nil {
+		return err
+	}
+
+	if chefID != 0 && order.AssignedToID == 0 {
+		if name, err := m.chefAt(order.LocationID, chefID); err == nil {
+			m.assignChef(order, chefID, name, actor)
+		}
+	}
+
+	previousStatus := order.Status
+	order.Status = status
+	order.Version++
+
+	if status == "Completed" {
+		if _, ok := m.tables[tableKey{order.LocationID, order.TableNumber}]; ok {
+			m.setTableStatus(order.LocationID, order.TableNumber, "Available")
+		}
+	}
+
+	m.recordEvent(order, EventStatusChanged, actor,
+		map[string]interface{}{"Status": previousStatus},
+		map[string]interface{}{"Status": status},
+	)
+	m.enqueue(order.LocationID, events.OrderStatusChanged, orderPayload(&order.Order))
+
+	return nil
+}
+
+func (m *Memory) AssignOrder(ctx context.Context, id, staffID int, actor string) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if Closed(order.Status) {
+		return nil, errorf(ErrOrderClosed, "order %d is %s and can no longer be assigned", id, order.Status)
+	}
+
+	var name string
+	if staffID == 0 {
+		staffID, name = m.chooseChef(order.LocationID, order.Items)
+		if staffID == 0 {
+			return nil, errorf(ErrInvalid, "no chef at location %d can cook order %d", order.LocationID, id)
+		}
+	} else {
+		name, err = m.chefAt(order.LocationID, staffID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.assignChef(order, staffID, name, actor)
+	m.enqueue(order.LocationID, events.OrderAssigned, orderPayload(&order.Order))
+
+	return copyOrder(order.Order), nil
+}
+
+func (m *Memory) CancelOrder(ctx context.Context, id int, reason string, confirmed bool, actor string) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCancellable(id, order.Status, confirmed); err != nil {
+		return nil, err
+	}
+
+	previousStatus := order.Status
+	order.Status = "Cancelled"
+	order.CancelReason = reason
+	order.Version++
+
+	m.recordEvent(order, EventCancelled, actor,
+		map[string]interface{}{"Status": previousStatus},
+		map[string]interface{}{"Status": "Cancelled", "Reason": reason, "Confirmed": confirmed},
+	)
+	m.enqueue(order.LocationID, events.OrderCancelled, orderPayload(&order.Order))
+
+	return copyOrder(order.Order), nil
+}
+
+func (m *Memory) RestoreInventory(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok || order.stockRestored {
+		return nil
+	}
+	order.stockRestored = true
+	m.adjustStock(order.LocationID, order.Items, 1)
+	return nil
+}
+
+func (m *Memory) DeleteOrder(ctx context.Context, id int, reason string, expectedVersion int, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(id, expectedVersion, order.Version); err != nil {
+		return err
+	}
+
+	deletedAt := now()
+	order.DeletedAt = &deletedAt
+	order.DeletedBy = actor
+	order.DeleteReason = reason
+	order.Version++
+
+	m.recordEvent(order, EventDeleted, actor,
+		map[string]interface{}{"Deleted": false},
+		map[string]interface{}{"Deleted": true, "Reason": reason, "OrderStatus": order.Status},
+	)
+	m.enqueue(order.LocationID, events.OrderDeleted, orderPayload(&order.Order))
+	return nil
+}
+
+func (m *Memory) RestoreOrder(ctx context.Context, id int, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok || order.DeletedAt == nil {
+		return errorf(ErrNotFound, "deleted order %d not found", id)
+	}
+
+	previous := map[string]interface{}{"Deleted": true, "DeletedBy": order.DeletedBy, "Reason": order.DeleteReason}
+	order.DeletedAt = nil
+	order.DeletedBy = ""
+	order.DeleteReason = ""
+	order.Version++
+
+	m.recordEvent(order, EventRestored, actor, previous, map[string]interface{}{"Deleted": false})
+	return nil
+}
+
+func (m *Memory) History(ctx context.Context, id int) (*OrderHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	return newHistory(id, order.LocationID, order.OrderTime, append([]OrderEvent(nil), order.events...), now()), nil
+}
+
+func (m *Memory) RecordPayment(ctx context.Context, payment Payment, actor string) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.openOrder(payment.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == "Cancelled" {
+		return nil, errorf(ErrOrderClosed, "order %d is cancelled and cannot be paid", payment.OrderID)
+	}
+
+	var paid money.Money
+	for _, p := range m.payments {
+		if p.OrderID == payment.OrderID && p.Status == PaymentCaptured {
+			paid = paid.Add(p.Amount)
+		}
+	}
+
+	payment, err = preparePayment(payment, order.TotalAmount, paid)
+	if err != nil {
+		return nil, err
+	}
+	payment.ID = len(m.payments) + 1
+	payment.CreatedAt = now()
+	m.payments = append(m.payments, payment)
+
+	previous, current := paymentEvent(payment, paid)
+	m.recordEvent(order, EventPaid, actor, previous, current)
+
+	return &payment, nil
+}
+
+func (m *Memory) VoidPendingPayments(ctx context.Context, orderID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	voided := 0
+	for i := range m.payments {
+		if m.payments[i].OrderID == orderID && m.payments[i].Status == PaymentPending {
+			m.payments[i].Status = PaymentVoided
+			voided++
+		}
+	}
+	return voided, nil
+}
+
+func (m *Memory) ListStaff(ctx context.Context, location int) ([]Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	staff := []Staff{}
+	for _, member := range m.staff {
+		if member.LocationID == location {
+			staff = append(staff, member)
+		}
+	}
+	sort.Slice(staff, func(i, j int) bool { return staff[i].Username < staff[j].Username })
+	return staff, nil
+}
+
+func (m *Memory) GetStaff(ctx context.Context, id int) (*Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	staff, ok := m.staff[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "staff member %d not found", id)
+	}
+	return &staff, nil
+}
+
+func (m *Memory) StaffByUsername(ctx context.Context, username string) (*Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, staff := range m.staff {
+		if staff.Username == username {
+			return &staff, nil
+		}
+	}
+	return nil, errorf(ErrNotFound, "staff member %q not found", username)
+}
+
+func (m *Memory) CreateStaff(ctx context.Context, staff Staff) (*Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.staff {
+		if existing.Username == staff.Username {
+			return nil, errorf(ErrExists, "username %q is taken", staff.Username)
+		}
+	}
+	if _, ok := m.locations[staff.LocationID]; !ok {
+		return nil, errorf(ErrNotFound, "location %d not found", staff.LocationID)
+	}
+	staff.ID = len(m.staff) + 1
+	staff.CreatedAt = time.Now()
+	m.staff[staff.ID] = staff
+	return &staff, nil
+}
+
+func (m *Memory) UpdateStaff(ctx context.Context, staff Staff) (*Staff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.staff[staff.ID]
+	if !ok {
+		return nil, errorf(ErrNotFound, "staff member %d not found", staff.ID)
+	}
+	if _, ok := m.locations[staff.LocationID]; !ok {
+		return nil, errorf(ErrNotFound, "location %d not found", staff.LocationID)
+	}
+	existing.Name = staff.Name
+	existing.Role = staff.Role
+	existing.LocationID = staff.LocationID
+	existing.Station = staff.Station
+	existing.Active = staff.Active
+	if staff.PasswordHash != "" {
+		existing.PasswordHash = staff.PasswordHash
+	}
+	m.staff[staff.ID] = existing
+	return &existing, nil
+}
+
+func (m *Memory) ListDevices(ctx context.Context, location int) ([]Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := []Device{}
+	for _, device := range m.devices {
+		if device.LocationID == location {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].TableNumber != devices[j].TableNumber {
+			return devices[i].TableNumber < devices[j].TableNumber
+		}
+		return devices[i].Name < devices[j].Name
+	})
+	return devices, nil
+}
+
+func (m *Memory) GetDevice(ctx context.Context, id string) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.devices[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "device %s not found", id)
+	}
+	return &device, nil
+}
+
+func (m *Memory) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tables[tableKey{device.LocationID, device.TableNumber}]; !ok {
+		return nil, errorf(ErrNotFound, "table %d not found", device.TableNumber)
+	}
+	device.CreatedAt = time.Now()
+	m.devices[device.ID] = device
+	return &device, nil
+}
+
+func (m *Memory) RotateDeviceSecret(ctx context.Context, id, secret string) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.devices[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "device %s not found", id)
+	}
+	if device.RevokedAt != nil {
+		return nil, errorf(ErrInvalid, "device %s is revoked", id)
+	}
+	now := time.Now()
+	device.Secret = secret
+	device.RotatedAt = &now
+	m.devices[id] = device
+	return &device, nil
+}
+
+func (m *Memory) RevokeDevice(ctx context.Context, id string) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, ok := m.devices[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "device %s not found", id)
+	}
+	if device.RevokedAt == nil {
+		now := time.Now()
+		device.RevokedAt = &now
+		m.devices[id] = device
+	}
+	return &device, nil
+}
+
+func (m *Memory) ListCustomers(ctx context.Context, search string) ([]Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customers := []Customer{}
+	for _, customer := range m.customers {
+		if search == "" || customer.Phone == search || customer.Email == strings.ToLower(search) ||
+			strings.Contains(strings.ToLower(customer.Name), strings.ToLower(search)) {
+			customers = append(customers, customer)
+		}
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		if customers[i].Name != customers[j].Name {
+			return customers[i].Name < customers[j].Name
+		}
+		return customers[i].ID < customers[j].ID
+	})
+	return customers, nil
+}
+
+func (m *Memory) GetCustomer(ctx context.Context, id int) (*Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customer, ok := m.customers[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "customer %d not found", id)
+	}
+	return &customer, nil
+}
+
+func (m *Memory) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	customer.Email = strings.ToLower(customer.Email)
+	if err := m.checkCustomer(customer); err != nil {
+		return nil, err
+	}
+	customer.ID = len(m.customers) + 1
+	customer.Points = 0
+	customer.CreatedAt = time.Now()
+	m.customers[customer.ID] = customer
+	return &customer, nil
+}
+
+func (m *Memory) UpdateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.customers[customer.ID]
+	if !ok {
+		return nil, errorf(ErrNotFound, "customer %d not found", customer.ID)
+	}
+	customer.Email = strings.ToLower(customer.Email)
+	if err := m.checkCustomer(customer); err != nil {
+		return nil, err
+	}
+	existing.Name, existing.Phone, existing.Email = customer.Name, customer.Phone, customer.Email
+	m.customers[customer.ID] = existing
+	return &existing, nil
+}
+
+func (m *Memory) LoyaltyHistory(ctx context.Context, customerID int) ([]LoyaltyTransaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customers[customerID]; !ok {
+		return nil, errorf(ErrNotFound, "customer %d not found", customerID)
+	}
+	transactions := []LoyaltyTransaction{}
+	for i := len(m.loyalty) - 1; i >= 0; i-- {
+		if m.loyalty[i].CustomerID == customerID {
+			transactions = append(transactions, m.loyalty[i])
+		}
+	}
+	return transactions, nil
+}
+
+func (m *Memory) AwardPoints(ctx context.Context, orderID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderID]
+	if !ok {
+		return 0, errorf(ErrNotFound, "order %d not found", orderID)
+	}
+	points := PointsFor(order.TotalAmount)
+	if order.CustomerID == 0 || order.Status != "Completed" || points == 0 {
+		return 0, nil
+	}
+	// A reversed order does not earn points any more, and an order earns them once
+	if m.settled(orderID, PointsEarned) || m.settled(orderID, PointsReversed) {
+		return 0, nil
+	}
+
+	m.changePoints(order.CustomerID, orderID, PointsEarned, points)
+	return points, nil
+}
+
+func (m *Memory) ReversePoints(ctx context.Context, orderID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderID]
+	if !ok {
+		return 0, errorf(ErrNotFound, "order %d not found", orderID)
+	}
+	if order.CustomerID == 0 || m.settled(orderID, PointsReversed) {
+		return 0, nil
+	}
+
+	net := 0
+	for _, t := range m.loyalty {
+		if t.OrderID == orderID {
+			net += t.Points
+		}
+	}
+	m.changePoints(order.CustomerID, orderID, PointsReversed, -net)
+	return -net, nil
+}
+
+// checkCustomer works like the constraints of the customers table. m.mu must be held.
+func (m *Memory) checkCustomer(customer Customer) error {
+	if customer.Phone == "" && customer.Email == "" {
+		return errorf(ErrInvalid, "a customer needs a phone number or an email address")
+	}
+	for _, existing := range m.customers {
+		if existing.ID == customer.ID {
+			continue
+		}
+		if customer.Phone != "" && existing.Phone == customer.Phone {
+			return errorf(ErrExists, "a customer with phone %q already exists", customer.Phone)
+		}
+		if customer.Email != "" && existing.Email == customer.Email {
+			return errorf(ErrExists, "a customer with email %q already exists", customer.Email)
+		}
+	}
+	return nil
+}
+
+// checkRedemption works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) checkRedemption(customerID, points int, total money.Money) (int, money.Money, error) {
+	if customerID == 0 {
+		return redeemable(customerID, 0, 0, total)
+	}
+	customer, ok := m.customers[customerID]
+	if !ok {
+		return 0, money.Money{}, errorf(ErrInvalid, "customer %d not found", customerID)
+	}
+	return redeemable(customerID, points, customer.Points, total)
+}
+
+// settled reports whether the order has a loyalty transaction of the kind. m.mu must be held.
+func (m *Memory) settled(orderID int, kind string) bool {
+	for _, t := range m.loyalty {
+		if t.OrderID == orderID && t.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// changePoints works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) changePoints(customerID, orderID int, kind string, points int) {
+	m.loyalty = append(m.loyalty, LoyaltyTransaction{
+		ID:         len(m.loyalty) + 1,
+		CustomerID: customerID,
+		OrderID:    orderID,
+		Kind:       kind,
+		Points:     points,
+		CreatedAt:  now(),
+	})
+	customer := m.customers[customerID]
+	customer.Points = max(customer.Points+points, 0)
+	m.customers[customerID] = customer
+}
+
+func (m *Memory) ListShifts(ctx context.Context, location int, from, to time.Time, staffID int) ([]Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shifts := []Shift{}
+	for _, shift := range m.shifts {
+		if shift.LocationID != location || (staffID != 0 && shift.StaffID != staffID) {
+			continue
+		}
+		start, end := shiftSpan(shift)
+		if start.Before(to) && (end == nil || end.After(from)) {
+			shifts = append(shifts, copyShift(shift))
+		}
+	}
+	sort.Slice(shifts, func(i, j int) bool {
+		a, _ := shiftSpan(&shifts[i])
+		b, _ := shiftSpan(&shifts[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return shifts[i].ID < shifts[j].ID
+	})
+	return shifts, nil
+}
+
+func (m *Memory) GetShift(ctx context.Context, id int) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, ok := m.shifts[id]
+	if !ok {
+		return nil, errorf(ErrNotFound, "shift %d not found", id)
+	}
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+func (m *Memory) ScheduleShift(ctx context.Context, shift Shift) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if shift.ScheduledStart == nil || shift.ScheduledEnd == nil || !shift.ScheduledEnd.After(*shift.ScheduledStart) {
+		return nil, errorf(ErrInvalid, "a shift must end after it starts")
+	}
+	staff, ok := m.staff[shift.StaffID]
+	if !ok {
+		return nil, errorf(ErrInvalid, "staff member %d not found", shift.StaffID)
+	}
+	if staff.LocationID != shift.LocationID {
+		return nil, errorf(ErrInvalid, "staff member %d does not work at location %d", shift.StaffID, shift.LocationID)
+	}
+
+	stored := m.newShift(staff, shift.LocationID, shift.Section)
+	start, end := *shift.ScheduledStart, *shift.ScheduledEnd
+	stored.ScheduledStart, stored.ScheduledEnd = &start, &end
+	copied := copyShift(stored)
+	return &copied, nil
+}
+
+func (m *Memory) DeleteShift(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, ok := m.shifts[id]
+	if !ok {
+		return errorf(ErrNotFound, "shift %d not found", id)
+	}
+	if shift.ClockIn != nil {
+		return errorf(ErrInvalid, "shift %d has been clocked into and is kept for the labor report", id)
+	}
+	delete(m.shifts, id)
+	return nil
+}
+
+func (m *Memory) CurrentShift(ctx context.Context, staffID int) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, err := m.openShift(staffID)
+	if err != nil {
+		return nil, err
+	}
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+func (m *Memory) ClockIn(ctx context.Context, staffID, location int, section string) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.openShift(staffID); err == nil {
+		return nil, errorf(ErrExists, "staff member %d is already clocked in", staffID)
+	}
+	staff, ok := m.staff[staffID]
+	if !ok {
+		return nil, errorf(ErrNotFound, "staff member %d not found", staffID)
+	}
+
+	// Start the scheduled shift that is under way or about to start, if any
+	at := now()
+	var shift *Shift
+	for _, scheduled := range m.shifts {
+		if scheduled.StaffID != staffID || scheduled.LocationID != location || scheduled.ClockIn != nil || scheduled.ScheduledStart == nil {
+			continue
+		}
+		if scheduled.ScheduledStart.After(at.Add(ShiftClockInWindow)) || !scheduled.ScheduledEnd.After(at) {
+			continue
+		}
+		if shift == nil || scheduled.ScheduledStart.Before(*shift.ScheduledStart) {
+			shift = scheduled
+		}
+	}
+	if shift == nil {
+		shift = m.newShift(staff, location, section)
+	}
+	if section != "" {
+		shift.Section = section
+	}
+	shift.ClockIn = &at
+
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+func (m *Memory) ClockOut(ctx context.Context, staffID int) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, err := m.openShift(staffID)
+	if err != nil {
+		return nil, err
+	}
+	at := now()
+	if n := len(shift.Breaks); n > 0 && shift.Breaks[n-1].EndedAt == nil {
+		shift.Breaks[n-1].EndedAt = &at
+	}
+	shift.ClockOut = &at
+
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+func (m *Memory) StartBreak(ctx context.Context, staffID int) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, err := m.openShift(staffID)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(shift.Breaks); n > 0 && shift.Breaks[n-1].EndedAt == nil {
+		return nil, errorf(ErrExists, "staff member %d is already on a break", staffID)
+	}
+	shift.Breaks = append(shift.Breaks, Break{StartedAt: now()})
+
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+func (m *Memory) EndBreak(ctx context.Context, staffID int) (*Shift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shift, err := m.openShift(staffID)
+	if err != nil {
+		return nil, err
+	}
+	n := len(shift.Breaks)
+	if n == 0 || shift.Breaks[n-1].EndedAt != nil {
+		return nil, errorf(ErrNotFound, "staff member %d is not on a break", staffID)
+	}
+	at := now()
+	shift.Breaks[n-1].EndedAt = &at
+
+	copied := copyShift(shift)
+	return &copied, nil
+}
+
+// newShift stores a new shift for the staff member. m.mu must be held.
+func (m *Memory) newShift(staff Staff, location int, section string) *Shift {
+	m.lastShiftID++
+	shift := &Shift{ID: m.lastShiftID, StaffID: staff.ID, StaffName: staff.Name, LocationID: location, Section: section, Breaks: []Break{}}
+	m.shifts[shift.ID] = shift
+	return shift
+}
+
+// openShift returns the shift the staff member is clocked into. m.mu must be held.
+func (m *Memory) openShift(staffID int) (*Shift, error) {
+	for _, shift := range m.shifts {
+		if shift.StaffID == staffID && shift.ClockIn != nil && shift.ClockOut == nil {
+			return shift, nil
+		}
+	}
+	return nil, errorf(ErrNotFound, "staff member %d is not clocked in", staffID)
+}
+
+// handlerFor works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) handlerFor(location, tableNumber, staffID int) (int, string) {
+	section := m.tables[tableKey{location, tableNumber}].Section
+
+	var chosen *Shift
+	for _, shift := range m.shifts {
+		if shift.LocationID != location || shift.ClockIn == nil || shift.ClockOut != nil {
+			continue
+		}
+		if staffID != 0 {
+			if shift.StaffID == staffID {
+				return shift.StaffID, shift.StaffName
+			}
+			continue
+		}
+		if m.staff[shift.StaffID].Role != "server" || (shift.Section != "" && shift.Section != section) {
+			continue
+		}
+		if n := len(shift.Breaks); n > 0 && shift.Breaks[n-1].EndedAt == nil {
+			continue
+		}
+		if chosen == nil || betterHandler(shift, chosen) {
+			chosen = shift
+		}
+	}
+	if chosen == nil {
+		return 0, ""
+	}
+	return chosen.StaffID, chosen.StaffName
+}
+
+// betterHandler orders the shifts of servers who could handle an order: those working
+// a section before those working the whole floor, then by clock-in time
+func betterHandler(a, b *Shift) bool {
+	if (a.Section == "") != (b.Section == "") {
+		return a.Section != ""
+	}
+	if !a.ClockIn.Equal(*b.ClockIn) {
+		return a.ClockIn.Before(*b.ClockIn)
+	}
+	return a.StaffID < b.StaffID
+}
+
+// shiftSpan returns when a shift starts and ends, as ListShifts compares them; the end
+// is nil for a shift under way
+func shiftSpan(shift *Shift) (time.Time, *time.Time) {
+	if shift.ClockIn == nil {
+		return *shift.ScheduledStart, shift.ScheduledEnd
+	}
+	return *shift.ClockIn, shift.ClockOut
+}
+
+// openOrder returns the order unless it does not exist or is deleted. m.mu must be held.
+func (m *Memory) openOrder(id int) (*memoryOrder, error) {
+	order, ok := m.orders[id]
+	if !ok || order.DeletedAt != nil {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	return order, nil
+}
+
+// price prices the items with the tax rates of their menu categories at the location,
+// for orders of the type. m.mu must be held.
+func (m *Memory) price(location int, orderType string, items []OrderItem) orderTotals {
+	rates := make(map[int]TaxRate)
+	for _, item := range items {
+		menuItem, ok := m.menu[item.ItemID]
+		if !ok || menuItem.LocationID != location {
+			continue
+		}
+		if rate, ok := rateFor(m.rates, menuItem.Category, orderType); ok {
+			rates[item.ItemID] = rate
+		}
+	}
+	return priceItems(items, rates)
+}
+
+// menuLines works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) menuLines(location int, items []OrderItem) ([]OrderItem, error) {
+	menu := make(map[int]MenuItem)
+	for _, item := range items {
+		if menuItem, ok := m.menu[item.ItemID]; ok && menuItem.LocationID == location {
+			menu[item.ItemID] = menuItem
+		}
+	}
+	return PriceFromMenu(items, menu)
+}
+
+// adjustStock works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) adjustStock(location int, items []OrderItem, direction int) {
+	for _, item := range items {
+		menuItem, ok := m.menu[item.ItemID]
+		if !ok || menuItem.LocationID != location || menuItem.Stock == nil {
+			continue
+		}
+		stock := *menuItem.Stock + direction*item.Quantity
+		menuItem.Stock = &stock
+		m.menu[item.ItemID] = menuItem
+		m.enqueue(location, events.MenuUpdated, events.MenuItem{ID: menuItem.ID, Name: menuItem.Name, Stock: &stock})
+	}
+}
+
+// chooseChef works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) chooseChef(location int, items []OrderItem) (int, string) {
+	stations := make(map[string]bool)
+	for _, item := range items {
+		if menuItem, ok := m.menu[item.ItemID]; ok && menuItem.LocationID == location {
+			station := menuItem.Station
+			if station == "" {
+				station = "kitchen"
+			}
+			stations[station] = true
+		}
+	}
+
+	load := make(map[int]int)
+	for _, order := range m.orders {
+		if order.AssignedToID != 0 && order.DeletedAt == nil && (order.Status == "Pending" || order.Status == "In Progress") {
+			load[order.AssignedToID]++
+		}
+	}
+
+	var chosen *Staff
+	for _, staff := range m.staff {
+		if staff.LocationID != location || staff.Role != "chef" || !staff.Active {
+			continue
+		}
+		if staff.Station != "" && !stations[staff.Station] {
+			continue
+		}
+		if chosen == nil || load[staff.ID] < load[chosen.ID] || (load[staff.ID] == load[chosen.ID] && staff.ID < chosen.ID) {
+			staff := staff
+			chosen = &staff
+		}
+	}
+	if chosen == nil {
+		return 0, ""
+	}
+	return chosen.ID, chosen.Name
+}
+
+// chefAt works like its Postgres counterpart. m.mu must be held.
+func (m *Memory) chefAt(location, staffID int) (string, error) {
+	staff, ok := m.staff[staffID]
+	if !ok {
+		return "", errorf(ErrInvalid, "staff member %d not found", staffID)
+	}
+	if staff.Role != "chef" || !staff.Active || staff.LocationID != location {
+		return "", errorf(ErrInvalid, "staff member %d is not an active chef at location %d", staffID, location)
+	}
+	return staff.Name, nil
+}
+
+// assignChef assigns the order to a chef and records the change. m.mu must be held.
+func (m *Memory) assignChef(order *memoryOrder, staffID int, name, actor string) {
+	previous := assignment(order.AssignedToID, order.AssignedTo)
+	order.AssignedToID = staffID
+	order.AssignedTo = name
+	order.Version++
+	m.recordEvent(order, EventAssigned, actor, previous, assignment(staffID, name))
+}
+
+// setTableStatus sets the table's status, creating the table if needed, and announces
+// it. m.mu must be held.
+func (m *Memory) setTableStatus(location, number int, status string) {
+	key := tableKey{location, number}
+	table, ok := m.tables[key]
+	if !ok {
+		table = Table{LocationID: location, Number: number, Capacity: 4, CodeVersion: 1}
+	}
+	table.Status = status
+	m.tables[key] = table
+	m.enqueue(location, events.TableUpdated, events.Table{Number: number, Status: status})
+}
+
+// recordEvent appends to the order's history. m.mu must be held.
+func (m *Memory) recordEvent(order *memoryOrder, eventType, actor string, previous, current interface{}) {
+	if actor == "" {
+		actor = SystemActor
+	}
+	m.lastEvID++
+	event := OrderEvent{ID: m.lastEvID, OrderID: order.ID, Type: eventType, Actor: actor, OccurredAt: now()}
+	if previous != nil {
+		event.Previous, _ = json.Marshal(previous)
+	}
+	if current != nil {
+		event.Current, _ = json.Marshal(current)
+	}
+	order.events = append(order.events, event)
+}
+
+// enqueue adds an event at the location to the outbox. m.mu must be held.
+func (m *Memory) enqueue(location int, eventType string, data interface{}) {
+	envelope, err := events.New(eventType, eventSource, location, data)
+	if err != nil {
+		panic(err) // Only fails when the system has no randomness
+	}
+	m.outbox = append(m.outbox, envelope)
+}
+
+// now is the current time at the precision Postgres keeps, so that cursors compare
+// the same way in both implementations
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// matches reports whether the order passes the query's filters
+func matches(q OrderQuery, order Order) bool {
+	if q.LocationID != 0 && order.LocationID != q.LocationID {
+		return false
+	}
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, status := range q.Statuses {
+			found = found || status == order.Status
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Type != "" && order.Type != q.Type {
+		return false
+	}
+	if q.TableNumber != 0 && order.TableNumber != q.TableNumber {
+		return false
+	}
+	if !q.From.IsZero() && order.OrderTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !order.OrderTime.Before(q.To) {
+		return false
+	}
+	if q.MenuItemID != 0 {
+		found := false
+		for _, item := range order.Items {
+			found = found || item.ItemID == q.MenuItemID
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.MinTotal != nil && order.TotalAmount.Amount < q.MinTotal.Amount {
+		return false
+	}
+	if q.MaxTotal != nil && order.TotalAmount.Amount > q.MaxTotal.Amount {
+		return false
+	}
+	return q.IncludeDeleted || order.DeletedAt == nil
+}
+
+// compareOrders compares the orders on the sort key, then on their ID
+func compareOrders(key string, a, b Order) int {
+	var c int
+	switch key {
+	case "total_amount":
+		c = compareInts(a.TotalAmount.Amount, b.TotalAmount.Amount)
+	case "table_number":
+		c = compareInts(int64(a.TableNumber), int64(b.TableNumber))
+	default:
+		c = a.OrderTime.Compare(b.OrderTime)
+	}
+	if c == 0 {
+		c = compareInts(int64(a.ID), int64(b.ID))
+	}
+	return c
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cursorOrder reads the cursor back into an order that compares like its last row
+func cursorOrder(key string, c cursor) (*Order, error) {
+	order := &Order{ID: c.ID}
+	var err error
+	switch key {
+	case "total_amount":
+		order.TotalAmount, err = money.Parse(c.Value, "")
+	case "table_number":
+		order.TableNumber, err = strconv.Atoi(c.Value)
+	default:
+		order.OrderTime, err = time.Parse("2006-01-02 15:04:05.999999", c.Value)
+	}
+	return order, err
+}
+
+func copyMenuItem(item MenuItem) MenuItem {
+	if item.Stock != nil {
+		stock := *item.Stock
+		item.Stock = &stock
+	}
+	return item
+}
+
+func copyShift(shift *Shift) Shift {
+	copied := *shift
+	copied.Breaks = append([]Break{}, shift.Breaks...)
+	return copied
+}
+
+func copyOrder(order Order) *Order {
+	order.Items = append([]OrderItem(nil), order.Items...)
+	order.TaxBreakdown = append([]TaxLine(nil), order.TaxBreakdown...)
+	if order.DeletedAt != nil {
+		deletedAt := *order.DeletedAt
+		order.DeletedAt = &deletedAt
+	}
+	return &order
+}
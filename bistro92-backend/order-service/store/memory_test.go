@@ -0,0 +1,359 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/common/money"
+)
+
+func newTestMemory() *Memory {
+	stock := 10
+	return NewMemory(
+		[]Location{{ID: 1, Name: "Main"}},
+		[]MenuItem{{ID: 1, LocationID: 1, Name: "Pizza", Price: money.New(1099, money.DefaultCurrency), Category: "Food", Stock: &stock}},
+		[]TaxRate{{Category: "Food", Name: "VAT", Rate: 0.1}},
+		[]Table{{LocationID: 1, Number: 3, Status: "Available"}},
+	)
+}
+
+func placeOrder(t *testing.T, m *Memory, order Order) int {
+	t.Helper()
+	if order.LocationID == 0 {
+		order.LocationID = 1
+	}
+	if order.Items == nil {
+		order.Items = []OrderItem{{ItemID: 1, Quantity: 2}}
+	}
+	id, err := m.CreateOrder(context.Background(), order, "test", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	return id
+}
+
+func stockOf(t *testing.T, m *Memory, id int) int {
+	t.Helper()
+	item, err := m.GetMenuItem(context.Background(), 1, id)
+	if err != nil {
+		t.Fatalf("GetMenuItem: %v", err)
+	}
+	return *item.Stock
+}
+
+func TestUpdateStatusRefusesClosedOrders(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+
+	completed := placeOrder(t, m, Order{TableNumber: 3})
+	for _, status := range []string{"In Progress", "Ready", "Completed"} {
+		if err := m.UpdateStatus(ctx, completed, status, 0, 0, "test"); err != nil {
+			t.Fatalf("UpdateStatus(%s): %v", status, err)
+		}
+	}
+
+	cancelled := placeOrder(t, m, Order{TableNumber: 3})
+	if _, err := m.CancelOrder(ctx, cancelled, "Guest left", false, "test"); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	stock := stockOf(t, m, 1)
+
+	for _, id := range []int{completed, cancelled} {
+		for _, status := range []string{"Pending", "In Progress", "Ready", "Completed"} {
+			err := m.UpdateStatus(ctx, id, status, 0, 0, "test")
+			if !errors.Is(err, ErrOrderClosed) {
+				t.Errorf("order %d to %s: got %v, want ErrOrderClosed", id, status, err)
+			}
+		}
+	}
+
+	if got := stockOf(t, m, 1); got != stock {
+		t.Errorf("stock changed from %d to %d", stock, got)
+	}
+	order, err := m.GetOrder(ctx, cancelled)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.Status != "Cancelled" {
+		t.Errorf("cancelled order is %s", order.Status)
+	}
+}
+
+func TestUpdateStatusFollowsTheOrderTypesFlow(t *testing.T) {
+	ctx := context.Background()
+	for _, orderType := range []string{OrderDineIn, OrderTakeaway, OrderDelivery} {
+		t.Run(orderType, func(t *testing.T) {
+			m := newTestMemory()
+			order := Order{Type: orderType, TableNumber: 3}
+			if orderType != OrderDineIn {
+				order = Order{Type: orderType, CustomerName: "Anna", CustomerPhone: "555 0142", DeliveryAddress: "1 Main St"}
+			}
+			id := placeOrder(t, m, order)
+
+			flow := StatusFlow(orderType)
+			for i, status := range flow[1:] {
+				// Skipping ahead and going back are refused
+				if i+2 < len(flow) {
+					if err := m.UpdateStatus(ctx, id, flow[i+2], 0, 0, "test"); !errors.Is(err, ErrInvalid) {
+						t.Errorf("%s to %s: got %v, want ErrInvalid", flow[i], flow[i+2], err)
+					}
+				}
+				if i > 0 {
+					if err := m.UpdateStatus(ctx, id, flow[i-1], 0, 0, "test"); !errors.Is(err, ErrInvalid) {
+						t.Errorf("%s back to %s: got %v, want ErrInvalid", flow[i], flow[i-1], err)
+					}
+				}
+				if err := m.UpdateStatus(ctx, id, status, 0, 0, "test"); err != nil {
+					t.Fatalf("%s to %s: %v", flow[i], status, err)
+				}
+			}
+
+			got, err := m.GetOrder(ctx, id)
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if got.Status != "Completed" {
+				t.Errorf("order is %s, want Completed", got.Status)
+			}
+		})
+	}
+}
+
+func TestRecordPaymentRefusesOtherCurrencies(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+	id := placeOrder(t, m, Order{TableNumber: 3})
+
+	payment := Payment{OrderID: id, Amount: money.New(500, "EUR"), Method: "card"}
+	if _, err := m.RecordPayment(ctx, payment, "test"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got %v, want ErrInvalid", err)
+	}
+	payment.Amount = money.New(500, money.DefaultCurrency)
+	if _, err := m.RecordPayment(ctx, payment, "test"); err != nil {
+		t.Errorf("RecordPayment: %v", err)
+	}
+}
+
+func TestCreateOrderTaxesByOrderType(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		orderType string
+		rate      float64
+		tax       int64
+	}{
+		{OrderDineIn, 0.1, 220},    // The rate for every type
+		{OrderTakeaway, 0.05, 110}, // The takeaway rate
+		{OrderDelivery, 0.1, 220},  // No delivery rate, so the rate for every type
+	}
+	for _, tt := range tests {
+		t.Run(tt.orderType, func(t *testing.T) {
+			m := newTestMemory()
+			m.rates[taxKey{"Food", OrderTakeaway}] = TaxRate{Category: "Food", OrderType: OrderTakeaway, Name: "Takeaway", Rate: 0.05}
+
+			order := Order{Type: tt.orderType, TableNumber: 3}
+			if tt.orderType != OrderDineIn {
+				order = Order{Type: tt.orderType, CustomerName: "Anna", CustomerPhone: "555 0142", DeliveryAddress: "1 Main St"}
+			}
+			got, err := m.GetOrder(ctx, placeOrder(t, m, order))
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+
+			tax := money.New(tt.tax, money.DefaultCurrency)
+			if got.TaxAmount != tax {
+				t.Errorf("tax = %s, want %s", got.TaxAmount, tax)
+			}
+			if len(got.TaxBreakdown) != 1 || got.TaxBreakdown[0].Rate != tt.rate {
+				t.Errorf("tax breakdown = %+v, want one line at %v", got.TaxBreakdown, tt.rate)
+			}
+		})
+	}
+}
+
+// listTestOrders places orders with repeated sort keys: a table number, total and type
+// are each shared by several of them. It returns the IDs in the order they were placed.
+func listTestOrders(t *testing.T, m *Memory) []int {
+	t.Helper()
+	takeaway := func(quantity int) Order {
+		return Order{Type: OrderTakeaway, CustomerName: "Anna", CustomerPhone: "555 0142", Items: []OrderItem{{ItemID: 1, Quantity: quantity}}}
+	}
+	return []int{
+		placeOrder(t, m, Order{TableNumber: 3, Items: []OrderItem{{ItemID: 1, Quantity: 1}}}),
+		placeOrder(t, m, takeaway(2)),
+		placeOrder(t, m, Order{TableNumber: 3, Items: []OrderItem{{ItemID: 1, Quantity: 2}}}),
+		placeOrder(t, m, takeaway(1)),
+		placeOrder(t, m, takeaway(1)),
+	}
+}
+
+func orderIDs(orders []Order) []int {
+	ids := []int{}
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
+
+func TestListOrdersFilters(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+	ids := listTestOrders(t, m)
+	if err := m.UpdateStatus(ctx, ids[1], "In Progress", 0, 0, "test"); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	if err := m.DeleteOrder(ctx, ids[4], "Test order", 0, "test"); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+	one := money.New(1099, money.DefaultCurrency).Scale(1.1)
+	two := money.New(2198, money.DefaultCurrency).Scale(1.1)
+
+	tests := []struct {
+		name  string
+		query OrderQuery
+		want  []int
+	}{
+		{"none", OrderQuery{}, ids[:4]},
+		{"location", OrderQuery{LocationID: 1}, ids[:4]},
+		{"other location", OrderQuery{LocationID: 2}, []int{}},
+		{"status", OrderQuery{Statuses: []string{"In Progress"}}, []int{ids[1]}},
+		{"statuses", OrderQuery{Statuses: []string{"Pending", "In Progress"}}, ids[:4]},
+		{"type", OrderQuery{Type: OrderTakeaway}, []int{ids[1], ids[3]}},
+		{"table", OrderQuery{TableNumber: 3}, []int{ids[0], ids[2]}},
+		{"menu item", OrderQuery{MenuItemID: 1}, ids[:4]},
+		{"other menu item", OrderQuery{MenuItemID: 2}, []int{}},
+		{"min total", OrderQuery{MinTotal: &two}, []int{ids[1], ids[2]}},
+		{"max total", OrderQuery{MaxTotal: &one}, []int{ids[0], ids[3]}},
+		{"from", OrderQuery{From: time.Now().Add(-time.Hour)}, ids[:4]},
+		{"to", OrderQuery{To: time.Now().Add(-time.Hour)}, []int{}},
+		{"deleted", OrderQuery{IncludeDeleted: true}, ids},
+		{"type and table", OrderQuery{Type: OrderTakeaway, TableNumber: 3}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Sort = "order_time"
+			page, err := m.ListOrders(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("ListOrders: %v", err)
+			}
+			if got := orderIDs(page.Orders); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orders = %v, want %v", got, tt.want)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("next cursor = %q on the only page", page.NextCursor)
+			}
+		})
+	}
+}
+
+func TestListOrdersPagesInSortOrder(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+	ids := listTestOrders(t, m)
+
+	// Orders with the same sort key come by ID, in the direction of the sort
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{"order_time", ids},
+		{"-order_time", []int{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{"total_amount", []int{ids[0], ids[3], ids[4], ids[1], ids[2]}},
+		{"-total_amount", []int{ids[2], ids[1], ids[4], ids[3], ids[0]}},
+		{"table_number", []int{ids[1], ids[3], ids[4], ids[0], ids[2]}},
+		{"-table_number", []int{ids[2], ids[0], ids[4], ids[3], ids[1]}},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 5} {
+			t.Run(fmt.Sprintf("%s by %d", tt.sort, limit), func(t *testing.T) {
+				var got []int
+				q := OrderQuery{Sort: tt.sort, Limit: limit}
+				for pages := 0; ; pages++ {
+					if pages > len(ids) {
+						t.Fatal("the cursor does not advance")
+					}
+					page, err := m.ListOrders(ctx, q)
+					if err != nil {
+						t.Fatalf("ListOrders: %v", err)
+					}
+					if len(page.Orders) > limit {
+						t.Fatalf("page of %d orders, limit %d", len(page.Orders), limit)
+					}
+					got = append(got, orderIDs(page.Orders)...)
+					if page.NextCursor == "" {
+						break
+					}
+					q.Cursor = page.NextCursor
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("orders = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestListOrdersRefusesBadCursors(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+	listTestOrders(t, m)
+
+	page, err := m.ListOrders(ctx, OrderQuery{Sort: "total_amount", Limit: 1})
+	if err != nil {
+		t.Fatalf("ListOrders: %v", err)
+	}
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", "total_amount", "not a cursor!"},
+		{"not JSON", "total_amount", base64.RawURLEncoding.EncodeToString([]byte("nope"))},
+		{"other sort", "-total_amount", page.NextCursor},
+		{"unreadable value", "total_amount", encodeCursor(cursor{Sort: "total_amount", Value: "ten", ID: 1})},
+		{"time for a table number", "table_number", encodeCursor(cursor{Sort: "table_number", Value: "2024-01-01 10:00:00", ID: 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.ListOrders(ctx, OrderQuery{Sort: tt.sort, Cursor: tt.cursor})
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("got %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestDeleteOrderSendsAnEventAndKeepsTheHistory(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory()
+	id := placeOrder(t, m, Order{TableNumber: 3})
+	if err := m.DeleteOrder(ctx, id, "Entered twice", 0, "test"); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+
+	outbox := m.Outbox()
+	last := outbox[len(outbox)-1]
+	if last.Type != events.OrderDeleted || last.Location != 1 {
+		t.Fatalf("last event is %s at %d, want %s at 1", last.Type, last.Location, events.OrderDeleted)
+	}
+	order, err := last.Order()
+	if err != nil {
+		t.Fatalf("Order: %v", err)
+	}
+	if order.ID != id || order.Reason != "Entered twice" {
+		t.Errorf("payload is order %d for %q, want order %d for %q", order.ID, order.Reason, id, "Entered twice")
+	}
+
+	history, err := m.History(ctx, id)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if history.LocationID != 1 || history.Events[len(history.Events)-1].Type != EventDeleted {
+		t.Errorf("history at %d ends with %+v, want a deletion at 1", history.LocationID, history.Events[len(history.Events)-1])
+	}
+}
@@ -0,0 +1,580 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/common/money"
+)
+
+// eventSource identifies this service in the envelope of the events it publishes
+const eventSource = "order-service"
+
+// Postgres implements the repositories on the order service database. Events are
+// written to the outbox table in the same transaction as the change they announce.
+type Postgres struct {
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Repositories returns p as each of the repositories
+func (p *Postgres) Repositories() Repositories {
+	return Repositories{Locations: p, Menu: p, Tables: p, Orders: p, Payments: p, Staff: p, Devices: p, Shifts: p, Customers: p}
+}
+
+const menuItemColumns = `id, location_id, name, price, COALESCE(category, ''), COALESCE(prep_time, 0), COALESCE(image_url, ''),
+	COALESCE(station, ''), stock`
+
+func scanMenuItem(row interface{ Scan(...interface{}) error }) (*MenuItem, error) {
+	var item MenuItem
+	var stock sql.NullInt64
+	err := row.Scan(&item.ID, &item.LocationID, &item.Name, &item.Price, &item.Category, &item.PrepTime, &item.ImageURL,
+		&item.Station, &stock)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Valid {
+		n := int(stock.Int64)
+		item.Stock = &n
+	}
+	return &item, nil
+}
+
+func (p *Postgres) ListMenuItems(ctx context.Context, location int) ([]MenuItem, error) {
+	return p.queryMenuItems(ctx, "SELECT "+menuItemColumns+" FROM menu_items WHERE location_id = $1 ORDER BY id", location)
+}
+
+func (p *Postgres) GetMenuItem(ctx context.Context, location, id int) (*MenuItem, error) {
+	item, err := scanMenuItem(p.db.QueryRowContext(
+		ctx,
+		"SELECT "+menuItemColumns+" FROM menu_items WHERE id = $1 AND location_id = $2",
+		id, location,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "menu item %d not found", id)
+	}
+	return item, err
+}
+
+func (p *Postgres) MenuItemsByID(ctx context.Context, location int, ids []int) (map[int]MenuItem, error) {
+	items, err := p.queryMenuItems(
+		ctx,
+		"SELECT "+menuItemColumns+" FROM menu_items WHERE id = ANY($1) AND location_id = $2",
+		pq.Array(ids), location,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]MenuItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	return byID, nil
+}
+
+func (p *Postgres) queryMenuItems(ctx context.Context, query string, args ...interface{}) ([]MenuItem, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []MenuItem{}
+	for rows.Next() {
+		item, err := scanMenuItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) ListTables(ctx context.Context, location int) ([]Table, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		"SELECT location_id, number, status, COALESCE(capacity, 0), COALESCE(section, ''), code_version FROM tables WHERE location_id = $1 ORDER BY number",
+		location,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []Table{}
+	for rows.Next() {
+		var table Table
+		if err := rows.Scan(&table.LocationID, &table.Number, &table.Status, &table.Capacity, &table.Section, &table.CodeVersion); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func (p *Postgres) GetTable(ctx context.Context, location, number int) (*Table, error) {
+	table := Table{LocationID: location, Number: number}
+	err := p.db.QueryRowContext(
+		ctx,
+		"SELECT status, COALESCE(capacity, 0), COALESCE(section, ''), code_version FROM tables WHERE location_id = $1 AND number = $2",
+		location, number,
+	).Scan(&table.Status, &table.Capacity, &table.Section, &table.CodeVersion)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "table %d not found", number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+func (p *Postgres) RotateTableCode(ctx context.Context, location, number int) (*Table, error) {
+	table := Table{LocationID: location, Number: number}
+	err := p.db.QueryRowContext(
+		ctx,
+		`UPDATE tables SET code_version = code_version + 1 WHERE location_id = $1 AND number = $2
+		 RETURNING status, COALESCE(capacity, 0), COALESCE(section, ''), code_version`,
+		location, number,
+	).Scan(&table.Status, &table.Capacity, &table.Section, &table.CodeVersion)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "table %d not found", number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+func (p *Postgres) ReleaseTableIfLastOpen(ctx context.Context, orderID int) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var location, tableNumber int
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE tables t
+		 SET status = 'Available'
+		 FROM orders o
+		 WHERE o.id = $1 AND t.location_id = o.location_id AND t.number = o.table_number
+		   AND NOT EXISTS (
+		       SELECT 1 FROM orders other
+		       WHERE other.location_id = o.location_id AND other.table_number = o.table_number AND other.id <> o.id
+		         AND other.status NOT IN ('Completed', 'Cancelled') AND other.deleted_at IS NULL
+		   )
+		 RETURNING t.location_id, t.number`,
+		orderID,
+	).Scan(&location, &tableNumber)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := enqueueTableEvent(ctx, tx, location, tableNumber, "Available"); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// orderColumns is the column list read by scanOrder
+const orderColumns = `id, location_id, order_type, COALESCE(table_number, 0), items, status, COALESCE(assigned_staff_id, 0), assigned_to,
+	COALESCE(handled_by_id, 0), handled_by, COALESCE(customer_id, 0), points_redeemed, discount_amount,
+	COALESCE(workflow_id, ''), COALESCE(customer_name, ''), COALESCE(customer_phone, ''), pickup_time,
+	COALESCE(delivery_address, ''), order_time,
+	COALESCE(total_amount, 0), COALESCE(tax_amount, 0), COALESCE(tax_breakdown, '[]'), notes, cancel_reason,
+	deleted_at, deleted_by, delete_reason, version`
+
+// scanOrder reads one row selected with orderColumns
+func scanOrder(row interface{ Scan(...interface{}) error }) (*Order, error) {
+	var id int
+	var location, tableNumber int
+	var orderType string
+	var itemsJSON []byte
+	var status string
+	var assignedToID, handledByID, customerID, pointsRedeemed int
+	var discount money.Money
+	var workflowID string
+	var customerName, customerPhone, deliveryAddress string
+	var pickupTime sql.NullTime
+	var assignedTo, handledBy sql.NullString
+	var orderTime time.Time
+	var totalAmount, taxAmount money.Money
+	var taxJSON []byte
+	var notes, cancelReason sql.NullString
+	var deletedAt sql.NullTime
+	var deletedBy, deleteReason sql.NullString
+	var version int
+
+	err := row.Scan(&id, &location, &orderType, &tableNumber, &itemsJSON, &status, &assignedToID, &assignedTo, &handledByID, &handledBy,
+		&customerID, &pointsRedeemed, &discount, &workflowID, &customerName, &customerPhone, &pickupTime, &deliveryAddress,
+		&orderTime, &totalAmount, &taxAmount, &taxJSON,
+		&notes, &cancelReason, &deletedAt, &deletedBy, &deleteReason, &version)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []OrderItem
+	err = json.Unmarshal(itemsJSON, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	var taxBreakdown []TaxLine
+	err = json.Unmarshal(taxJSON, &taxBreakdown)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &Order{
+		ID:              id,
+		LocationID:      location,
+		Type:            orderType,
+		TableNumber:     tableNumber,
+		Items:           items,
+		Status:          status,
+		AssignedToID:    assignedToID,
+		AssignedTo:      assignedTo.String,
+		HandledByID:     handledByID,
+		HandledBy:       handledBy.String,
+		CustomerID:      customerID,
+		PointsRedeemed:  pointsRedeemed,
+		Discount:        discount,
+		WorkflowID:      workflowID,
+		CustomerName:    customerName,
+		CustomerPhone:   customerPhone,
+		DeliveryAddress: deliveryAddress,
+		OrderTime:       orderTime,
+		TotalAmount:     totalAmount,
+		TaxAmount:       taxAmount,
+		TaxBreakdown:    taxBreakdown,
+		Notes:           notes.String,
+		CancelReason:    cancelReason.String,
+		DeletedBy:       deletedBy.String,
+		DeleteReason:    deleteReason.String,
+		Version:         version,
+	}
+	if deletedAt.Valid {
+		order.DeletedAt = &deletedAt.Time
+	}
+	if pickupTime.Valid {
+		order.PickupTime = &pickupTime.Time
+	}
+
+	return order, nil
+}
+
+// priceOrder prices the items with the tax rates configured for their menu categories
+// and the order type, preferring a rate for the type over the one for every type. Items
+// whose category has no configured rate, or that are not on the location's menu, are
+// not taxed.
+func priceOrder(ctx context.Context, tx *sql.Tx, location int, orderType string, items []OrderItem) (orderTotals, error) {
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, int64(item.ItemID))
+	}
+	if orderType == "" {
+		orderType = OrderDineIn
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT DISTINCT ON (m.id) m.id, t.category, t.order_type, t.name, t.rate, t.inclusive
+		 FROM menu_items m
+		 JOIN tax_rates t ON t.category = m.category AND t.order_type IN ('', $3)
+		 WHERE m.id = ANY($1) AND m.location_id = $2
+		 ORDER BY m.id, t.order_type = ''`,
+		pq.Array(ids), location, orderType,
+	)
+	if err != nil {
+		return orderTotals{}, err
+	}
+	defer rows.Close()
+
+	rates := make(map[int]TaxRate)
+	for rows.Next() {
+		var itemID int
+		var rate TaxRate
+		if err := rows.Scan(&itemID, &rate.Category, &rate.OrderType, &rate.Name, &rate.Rate, &rate.Inclusive); err != nil {
+			return orderTotals{}, err
+		}
+		rates[itemID] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return orderTotals{}, err
+	}
+
+	return priceItems(items, rates), nil
+}
+
+// menuLines prices the order lines from the location's menu, see PriceFromMenu
+func menuLines(ctx context.Context, tx *sql.Tx, location int, items []OrderItem) ([]OrderItem, error) {
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, int64(item.ItemID))
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT "+menuItemColumns+" FROM menu_items WHERE id = ANY($1) AND location_id = $2",
+		pq.Array(ids), location,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menu := make(map[int]MenuItem)
+	for rows.Next() {
+		item, err := scanMenuItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		menu[item.ID] = *item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return PriceFromMenu(items, menu)
+}
+
+// adjustStock adds (direction 1) or removes (direction -1) the item quantities from
+// the stock of the location's menu items that track it, announcing the new stock levels.
+func adjustStock(ctx context.Context, tx *sql.Tx, location int, items []OrderItem, direction int) error {
+	for _, item := range items {
+		var menuItem events.MenuItem
+		err := tx.QueryRowContext(
+			ctx,
+			`UPDATE menu_items SET stock = stock + $1
+			 WHERE id = $2 AND location_id = $3 AND stock IS NOT NULL
+			 RETURNING id, name, stock`,
+			direction*item.Quantity, item.ItemID, location,
+		).Scan(&menuItem.ID, &menuItem.Name, &menuItem.Stock)
+		if err == sql.ErrNoRows {
+			continue // Stock is not tracked for this item
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := enqueueOutbox(ctx, tx, location, events.MenuUpdated, menuItem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chooseChef picks the least busy active chef at the location for the items: the one
+// with the fewest Pending and In Progress orders among the chefs cooking at one of the
+// items' stations or at any station. It returns 0 when there is none.
+func chooseChef(ctx context.Context, tx *sql.Tx, location int, items []OrderItem) (int, string, error) {
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, int64(item.ItemID))
+	}
+
+	var id int
+	var name string
+	err := tx.QueryRowContext(
+		ctx,
+		`SELECT s.id, s.name
+		 FROM staff s
+		 LEFT JOIN orders o ON o.assigned_staff_id = s.id
+		   AND o.status IN ('Pending', 'In Progress') AND o.deleted_at IS NULL
+		 WHERE s.location_id = $1 AND s.role = 'chef' AND s.active
+		   AND (s.station IS NULL OR s.station IN (
+		       SELECT COALESCE(m.station, 'kitchen') FROM menu_items m WHERE m.id = ANY($2) AND m.location_id = $1
+		   ))
+		 GROUP BY s.id, s.name
+		 ORDER BY COUNT(o.id), s.id
+		 LIMIT 1`,
+		location, pq.Array(ids),
+	).Scan(&id, &name)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return id, name, err
+}
+
+// handlerFor returns the clocked-in staff member handling a new order at the location:
+// staffID when they are clocked in there or, for orders placed without a staff member,
+// the server clocked into the table's section, or else into the whole floor, who is not
+// on a break and clocked in first. It returns 0 when there is none.
+func handlerFor(ctx context.Context, tx *sql.Tx, location, tableNumber, staffID int) (int, string, error) {
+	query := `SELECT s.id, s.name
+		 FROM shifts sh JOIN staff s ON s.id = sh.staff_id
+		 WHERE sh.location_id = $1 AND sh.clock_in IS NOT NULL AND sh.clock_out IS NULL AND s.id = $2`
+	args := []interface{}{location, staffID}
+	if staffID == 0 {
+		query = `SELECT s.id, s.name
+		 FROM shifts sh
+		 JOIN staff s ON s.id = sh.staff_id
+		 LEFT JOIN tables t ON t.location_id = sh.location_id AND t.number = $2
+		 WHERE sh.location_id = $1 AND sh.clock_in IS NOT NULL AND sh.clock_out IS NULL
+		   AND s.role = 'server' AND (sh.section IS NULL OR sh.section = t.section)
+		   AND NOT EXISTS (SELECT 1 FROM shift_breaks b WHERE b.shift_id = sh.id AND b.ended_at IS NULL)
+		 ORDER BY sh.section IS NULL, sh.clock_in, s.id
+		 LIMIT 1`
+		args = []interface{}{location, tableNumber}
+	}
+
+	var id int
+	var name string
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&id, &name)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return id, name, err
+}
+
+// chefAt returns the name of the staff member, who must be an active chef at the location
+func chefAt(ctx context.Context, tx *sql.Tx, location, staffID int) (string, error) {
+	var name, role string
+	var staffLocation int
+	var active bool
+	err := tx.QueryRowContext(
+		ctx,
+		"SELECT name, role, location_id, active FROM staff WHERE id = $1",
+		staffID,
+	).Scan(&name, &role, &staffLocation, &active)
+	if err == sql.ErrNoRows {
+		return "", errorf(ErrInvalid, "staff member %d not found", staffID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if role != "chef" || !active || staffLocation != location {
+		return "", errorf(ErrInvalid, "staff member %d is not an active chef at location %d", staffID, location)
+	}
+	return name, nil
+}
+
+// assignChef assigns the order to a chef, taking over from the previous one if any, and
+// records the change in its history
+func assignChef(ctx context.Context, tx *sql.Tx, orderID, previousID int, previousName string, staffID int, name, actor string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"UPDATE orders SET assigned_staff_id = $1, assigned_to = $2, version = version + 1 WHERE id = $3",
+		staffID, name, orderID,
+	)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, tx, orderID, EventAssigned, actor, assignment(previousID, previousName), assignment(staffID, name))
+}
+
+// assignment is how an assignment is recorded in an order's history; nil when the order
+// is not assigned
+func assignment(staffID int, name string) interface{} {
+	if staffID == 0 {
+		return nil
+	}
+	return map[string]interface{}{"AssignedToID": staffID, "AssignedTo": name}
+}
+
+// recordEvent appends an event to the order's history inside the caller's transaction,
+// so the change and its record commit together. previous and current are stored as
+// JSON and may be nil.
+func recordEvent(ctx context.Context, tx *sql.Tx, orderID int, eventType, actor string, previous, current interface{}) error {
+	if actor == "" {
+		actor = SystemActor
+	}
+
+	previousJSON, err := nullableJSON(previous)
+	if err != nil {
+		return err
+	}
+	currentJSON, err := nullableJSON(current)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO order_events (order_id, location_id, event_type, actor, previous, current)
+		 VALUES ($1, (SELECT location_id FROM orders WHERE id = $1), $2, $3, $4, $5)`,
+		orderID, eventType, actor, previousJSON, currentJSON,
+	)
+	return err
+}
+
+func nullableJSON(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// enqueueOrderEvent reads the order as changed by the transaction and writes an event
+// of the given type for it to the outbox. The order is returned for the caller's
+// convenience.
+func enqueueOrderEvent(ctx context.Context, tx *sql.Tx, orderID int, eventType string) (*Order, error) {
+	order, err := scanOrder(tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", orderID))
+	if err != nil {
+		return nil, err
+	}
+
+	return order, enqueueOutbox(ctx, tx, order.LocationID, eventType, orderPayload(order))
+}
+
+// enqueueTableEvent writes a table's new status to the outbox
+func enqueueTableEvent(ctx context.Context, tx *sql.Tx, location, number int, status string) error {
+	return enqueueOutbox(ctx, tx, location, events.TableUpdated, events.Table{Number: number, Status: status})
+}
+
+// enqueueOutbox wraps the payload in an event envelope and writes it to the outbox
+// within the transaction making the change, so that the event is sent if and only if
+// the change is committed. It is routed by location and event type.
+func enqueueOutbox(ctx context.Context, tx *sql.Tx, location int, eventType string, data interface{}) error {
+	envelope, err := events.New(eventType, eventSource, location, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO outbox (routing_key, payload) VALUES ($1, $2)",
+		events.RoutingKey(location, eventType), payload,
+	)
+	return err
+}
+
+// orderPayload is the event payload for an order. Reason is filled in for cancellations
+// and deletions.
+func orderPayload(order *Order) events.Order {
+	payload := events.Order{
+		ID:           order.ID,
+		Type:         order.Type,
+		TableNumber:  order.TableNumber,
+		CustomerName: order.CustomerName,
+		PickupTime:   order.PickupTime,
+		Items:        make([]events.OrderItem, len(order.Items)),
+		Status:       order.Status,
+		AssignedTo:   order.AssignedTo,
+	}
+	for i, item := range order.Items {
+		payload.Items[i] = events.OrderItem(item)
+	}
+	if order.DeletedAt != nil {
+		payload.Reason = order.DeleteReason
+	} else if order.Status == "Cancelled" {
+		payload.Reason = order.CancelReason
+	}
+	return payload
+}
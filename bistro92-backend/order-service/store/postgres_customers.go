@@ -0,0 +1,265 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+const customerColumns = "id, name, COALESCE(phone, ''), COALESCE(email, ''), points, created_at"
+
+func scanCustomer(row interface{ Scan(...interface{}) error }) (*Customer, error) {
+	var customer Customer
+	err := row.Scan(&customer.ID, &customer.Name, &customer.Phone, &customer.Email, &customer.Points, &customer.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// customerError turns the violations of the customers table's constraints into store
+// errors
+func customerError(err error, customer Customer) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		if strings.Contains(pqErr.Constraint, "email") {
+			return errorf(ErrExists, "a customer with email %q already exists", customer.Email)
+		}
+		return errorf(ErrExists, "a customer with phone %q already exists", customer.Phone)
+	}
+	if errors.As(err, &pqErr) && pqErr.Code == "23514" { // check_violation
+		return errorf(ErrInvalid, "a customer needs a phone number or an email address")
+	}
+	return err
+}
+
+func (p *Postgres) ListCustomers(ctx context.Context, search string) ([]Customer, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT `+customerColumns+` FROM customers
+		 WHERE $1 = '' OR phone = $1 OR email = LOWER($1) OR name ILIKE '%' || $1 || '%'
+		 ORDER BY name, id`,
+		search,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := []Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, *customer)
+	}
+	return customers, rows.Err()
+}
+
+func (p *Postgres) GetCustomer(ctx context.Context, id int) (*Customer, error) {
+	customer, err := scanCustomer(p.db.QueryRowContext(ctx, "SELECT "+customerColumns+" FROM customers WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "customer %d not found", id)
+	}
+	return customer, err
+}
+
+func (p *Postgres) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	customer.Email = strings.ToLower(customer.Email)
+	created, err := scanCustomer(p.db.QueryRowContext(
+		ctx,
+		`INSERT INTO customers (name, phone, email) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+		 RETURNING `+customerColumns,
+		customer.Name, customer.Phone, customer.Email,
+	))
+	if err != nil {
+		return nil, customerError(err, customer)
+	}
+	return created, nil
+}
+
+func (p *Postgres) UpdateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	customer.Email = strings.ToLower(customer.Email)
+	updated, err := scanCustomer(p.db.QueryRowContext(
+		ctx,
+		`UPDATE customers SET name = $2, phone = NULLIF($3, ''), email = NULLIF($4, '')
+		 WHERE id = $1 RETURNING `+customerColumns,
+		customer.ID, customer.Name, customer.Phone, customer.Email,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "customer %d not found", customer.ID)
+	}
+	if err != nil {
+		return nil, customerError(err, customer)
+	}
+	return updated, nil
+}
+
+func (p *Postgres) LoyaltyHistory(ctx context.Context, customerID int) ([]LoyaltyTransaction, error) {
+	if _, err := p.GetCustomer(ctx, customerID); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT id, customer_id, order_id, kind, points, created_at FROM loyalty_transactions
+		 WHERE customer_id = $1 ORDER BY created_at DESC, id DESC`,
+		customerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []LoyaltyTransaction{}
+	for rows.Next() {
+		var t LoyaltyTransaction
+		if err := rows.Scan(&t.ID, &t.CustomerID, &t.OrderID, &t.Kind, &t.Points, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+func (p *Postgres) AwardPoints(ctx context.Context, orderID int) (int, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var customerID int
+	var status string
+	var total money.Money
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(customer_id, 0), status, COALESCE(total_amount, 0) FROM orders WHERE id = $1 FOR UPDATE",
+		orderID,
+	).Scan(&customerID, &status, &total)
+	if err == sql.ErrNoRows {
+		return 0, errorf(ErrNotFound, "order %d not found", orderID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	points := PointsFor(total)
+	if customerID == 0 || status != "Completed" || points == 0 {
+		return 0, nil
+	}
+
+	// A reversed order does not earn points any more, and an order earns them once
+	var settled bool
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM loyalty_transactions WHERE order_id = $1 AND kind IN ($2, $3))",
+		orderID, PointsEarned, PointsReversed,
+	).Scan(&settled)
+	if err != nil {
+		return 0, err
+	}
+	if settled {
+		return 0, nil
+	}
+
+	if err := changePoints(ctx, tx, customerID, orderID, PointsEarned, points); err != nil {
+		return 0, err
+	}
+	return points, tx.Commit()
+}
+
+func (p *Postgres) ReversePoints(ctx context.Context, orderID int) (int, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var customerID int
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(customer_id, 0) FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		return 0, errorf(ErrNotFound, "order %d not found", orderID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if customerID == 0 {
+		return 0, nil
+	}
+
+	var net int
+	var reversed bool
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(SUM(points) FILTER (WHERE kind <> $2), 0), COUNT(*) FILTER (WHERE kind = $2) > 0
+		 FROM loyalty_transactions WHERE order_id = $1`,
+		orderID, PointsReversed,
+	).Scan(&net, &reversed)
+	if err != nil {
+		return 0, err
+	}
+	if reversed {
+		return 0, nil
+	}
+
+	// Record the reversal even when nothing changes, so that the order earns nothing later
+	if err := changePoints(ctx, tx, customerID, orderID, PointsReversed, -net); err != nil {
+		return 0, err
+	}
+	return -net, tx.Commit()
+}
+
+// checkRedemption checks that the customer exists and has the points to redeem, and
+// returns the points redeemed on an order with this total and what they take off it.
+// The customer is locked until the transaction ends, so that the points cannot be
+// spent twice.
+func checkRedemption(ctx context.Context, tx *sql.Tx, customerID, points int, total money.Money) (int, money.Money, error) {
+	if customerID == 0 {
+		return redeemable(customerID, 0, 0, total)
+	}
+
+	var balance int
+	err := tx.QueryRowContext(ctx, "SELECT points FROM customers WHERE id = $1 FOR UPDATE", customerID).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, money.Money{}, errorf(ErrInvalid, "customer %d not found", customerID)
+	}
+	if err != nil {
+		return 0, money.Money{}, err
+	}
+	return redeemable(customerID, points, balance, total)
+}
+
+// redeemable returns the points redeemed on an order with this total and what they take
+// off it. Points are only redeemed up to the total, never more than the balance.
+func redeemable(customerID, points, balance int, total money.Money) (int, money.Money, error) {
+	if points > balance {
+		return 0, money.Money{}, errorf(ErrInvalid, "customer %d has %d points, not %d", customerID, balance, points)
+	}
+	if limit := int(total.Amount / PointValue); points > limit {
+		points = max(limit, 0)
+	}
+	return points, money.New(int64(points)*PointValue, money.DefaultCurrency), nil
+}
+
+// changePoints records a loyalty transaction and applies it to the customer's balance.
+// A balance never goes below 0, e.g. when points earned by an order that is cancelled
+// later have already been spent.
+func changePoints(ctx context.Context, tx *sql.Tx, customerID, orderID int, kind string, points int) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO loyalty_transactions (customer_id, order_id, kind, points) VALUES ($1, $2, $3, $4)",
+		customerID, orderID, kind, points,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE customers SET points = GREATEST(points + $2, 0) WHERE id = $1", customerID, points)
+	return err
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const deviceColumns = "id, name, location_id, table_number, created_at, rotated_at, revoked_at, secret"
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (*Device, error) {
+	var device Device
+	var rotatedAt, revokedAt sql.NullTime
+	err := row.Scan(&device.ID, &device.Name, &device.LocationID, &device.TableNumber, &device.CreatedAt, &rotatedAt, &revokedAt,
+		&device.Secret)
+	if err != nil {
+		return nil, err
+	}
+	if rotatedAt.Valid {
+		device.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		device.RevokedAt = &revokedAt.Time
+	}
+	return &device, nil
+}
+
+func (p *Postgres) ListDevices(ctx context.Context, location int) ([]Device, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		"SELECT "+deviceColumns+" FROM devices WHERE location_id = $1 ORDER BY table_number, name",
+		location,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+	return devices, rows.Err()
+}
+
+func (p *Postgres) GetDevice(ctx context.Context, id string) (*Device, error) {
+	device, err := scanDevice(p.db.QueryRowContext(ctx, "SELECT "+deviceColumns+" FROM devices WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "device %s not found", id)
+	}
+	return device, err
+}
+
+func (p *Postgres) CreateDevice(ctx context.Context, device Device) (*Device, error) {
+	err := p.db.QueryRowContext(
+		ctx,
+		`INSERT INTO devices (id, name, location_id, table_number, secret)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING created_at`,
+		device.ID, device.Name, device.LocationID, device.TableNumber, device.Secret,
+	).Scan(&device.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return nil, errorf(ErrNotFound, "table %d not found", device.TableNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (p *Postgres) RotateDeviceSecret(ctx context.Context, id, secret string) (*Device, error) {
+	device, err := scanDevice(p.db.QueryRowContext(
+		ctx,
+		"UPDATE devices SET secret = $2, rotated_at = NOW() WHERE id = $1 AND revoked_at IS NULL RETURNING "+deviceColumns,
+		id, secret,
+	))
+	if err == sql.ErrNoRows {
+		if _, err := p.GetDevice(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, errorf(ErrInvalid, "device %s is revoked", id)
+	}
+	return device, err
+}
+
+func (p *Postgres) RevokeDevice(ctx context.Context, id string) (*Device, error) {
+	device, err := scanDevice(p.db.QueryRowContext(
+		ctx,
+		"UPDATE devices SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1 RETURNING "+deviceColumns,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "device %s not found", id)
+	}
+	return device, err
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const locationColumns = "id, name, COALESCE(address, ''), COALESCE(phone, ''), created_at"
+
+func scanLocation(row interface{ Scan(...interface{}) error }) (*Location, error) {
+	var location Location
+	err := row.Scan(&location.ID, &location.Name, &location.Address, &location.Phone, &location.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+func (p *Postgres) ListLocations(ctx context.Context) ([]Location, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT "+locationColumns+" FROM locations ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+	for rows.Next() {
+		location, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, *location)
+	}
+	return locations, rows.Err()
+}
+
+func (p *Postgres) GetLocation(ctx context.Context, id int) (*Location, error) {
+	location, err := scanLocation(p.db.QueryRowContext(ctx, "SELECT "+locationColumns+" FROM locations WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "location %d not found", id)
+	}
+	return location, err
+}
+
+func (p *Postgres) CreateLocation(ctx context.Context, location Location) (*Location, error) {
+	err := p.db.QueryRowContext(
+		ctx,
+		"INSERT INTO locations (name, address, phone) VALUES ($1, $2, $3) RETURNING id, created_at",
+		location.Name, location.Address, location.Phone,
+	).Scan(&location.ID, &location.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
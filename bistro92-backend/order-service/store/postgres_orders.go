@@ -0,0 +1,862 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/common/money"
+)
+
+// sortColumns maps the sort keys to their column and the type the cursor value is
+// cast to
+var sortColumns = map[string]struct{ column, cast string }{
+	"order_time":   {"order_time", "timestamp"},
+	"total_amount": {"COALESCE(total_amount, 0)", "numeric"},
+	"table_number": {"COALESCE(table_number, 0)", "int"},
+}
+
+func (p *Postgres) CreateOrder(ctx context.Context, order Order, actor, ref string) (int, error) {
+	// Start a transaction
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if order.Type == "" {
+		order.Type = OrderDineIn
+	}
+
+	// Occupy the table, creating it if it does not exist yet; takeaway and delivery
+	// orders have none
+	if order.TableNumber != 0 {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO tables (location_id, number, status) VALUES ($1, $2, 'Occupied')
+			 ON CONFLICT (location_id, number) DO UPDATE SET status = 'Occupied'`,
+			order.LocationID, order.TableNumber,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The lines are priced from the menu, never from the request
+	order.Items, err = menuLines(ctx, tx, order.LocationID, order.Items)
+	if err != nil {
+		return 0, err
+	}
+
+	// Calculate total amount and tax
+	totals, err := priceOrder(ctx, tx, order.LocationID, order.Type, order.Items)
+	if err != nil {
+		return 0, err
+	}
+
+	// Redeemed points are taken off the total
+	points, discount, err := checkRedemption(ctx, tx, order.CustomerID, order.PointsRedeemed, totals.Total)
+	if err != nil {
+		return 0, err
+	}
+	total := totals.Total.Sub(discount)
+	order.PointsRedeemed = points
+
+	// Take the items out of stock; they are put back if the order is cancelled
+	if err := adjustStock(ctx, tx, order.LocationID, order.Items, -1); err != nil {
+		return 0, err
+	}
+
+	chefID, chefName, err := chooseChef(ctx, tx, order.LocationID, order.Items)
+	if err != nil {
+		return 0, err
+	}
+	handlerID, handlerName, err := handlerFor(ctx, tx, order.LocationID, order.TableNumber, order.HandledByID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Now insert the order
+	itemsJSON, err := json.Marshal(order.Items)
+	if err != nil {
+		return 0, err
+	}
+
+	taxJSON, err := json.Marshal(totals.TaxBreakdown)
+	if err != nil {
+		return 0, err
+	}
+
+	var orderID int
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO orders (location_id, order_type, table_number, items, status, total_amount, tax_amount, tax_breakdown, notes,
+		     assigned_staff_id, assigned_to, handled_by_id, handled_by, customer_id, points_redeemed, discount_amount, workflow_id,
+		     customer_name, customer_phone, pickup_time, delivery_address)
+		 VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, NULLIF($10, 0), NULLIF($11, ''), NULLIF($12, 0), NULLIF($13, ''),
+		     NULLIF($14, 0), $15, $16, NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), $20, NULLIF($21, ''))
+		 RETURNING id`,
+		order.LocationID,
+		order.Type,
+		order.TableNumber,
+		itemsJSON,
+		"Pending",
+		total,
+		totals.TaxAmount,
+		taxJSON,
+		order.Notes,
+		chefID,
+		chefName,
+		handlerID,
+		handlerName,
+		order.CustomerID,
+		order.PointsRedeemed,
+		discount,
+		ref,
+		order.CustomerName,
+		order.CustomerPhone,
+		order.PickupTime,
+		order.DeliveryAddress,
+	).Scan(&orderID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if order.PointsRedeemed > 0 {
+		if err := changePoints(ctx, tx, order.CustomerID, orderID, PointsRedeemed, -order.PointsRedeemed); err != nil {
+			return 0, err
+		}
+	}
+
+	// Link the order to the Idempotency-Key of the request, in the same transaction so
+	// that the two never diverge
+	if ref != "" {
+		_, err = tx.ExecContext(ctx, "UPDATE idempotency_keys SET order_id = $1 WHERE workflow_id = $2", orderID, ref)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Insert notification for new order
+	message := fmt.Sprintf("New order received for table %d", order.TableNumber)
+	if order.TableNumber == 0 {
+		message = fmt.Sprintf("New %s order received for %s", order.Type, order.CustomerName)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO notifications (order_id, location_id, notification_type, message)
+		 VALUES ($1, $2, $3, $4)`,
+		orderID,
+		order.LocationID,
+		"new_order",
+		message,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = recordEvent(ctx, tx, orderID, EventCreated, actor, nil, map[string]interface{}{
+		"Status":         "Pending",
+		"Type":           order.Type,
+		"TableNumber":    order.TableNumber,
+		"CustomerName":   order.CustomerName,
+		"PickupTime":     order.PickupTime,
+		"Items":          order.Items,
+		"TotalAmount":    total,
+		"Notes":          order.Notes,
+		"HandledBy":      handlerName,
+		"CustomerID":     order.CustomerID,
+		"PointsRedeemed": order.PointsRedeemed,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if chefID != 0 {
+		if err := recordEvent(ctx, tx, orderID, EventAssigned, SystemActor, nil, assignment(chefID, chefName)); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := enqueueOrderEvent(ctx, tx, orderID, events.OrderCreated); err != nil {
+		return 0, err
+	}
+	if order.TableNumber != 0 {
+		if err := enqueueTableEvent(ctx, tx, order.LocationID, order.TableNumber, "Occupied"); err != nil {
+			return 0, err
+		}
+	}
+
+	// Commit transaction
+	return orderID, tx.Commit()
+}
+
+// GetOrder returns the order, including a soft-deleted one; check DeletedAt
+func (p *Postgres) GetOrder(ctx context.Context, id int) (*Order, error) {
+	order, err := scanOrder(p.db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	return order, err
+}
+
+// ListOrders returns one page of orders matching the query. Pages use keyset
+// pagination on the sort column and the order ID, so they stay stable while new
+// orders come in.
+func (p *Postgres) ListOrders(ctx context.Context, q OrderQuery) (*OrderPage, error) {
+	q.normalize()
+
+	key := strings.TrimPrefix(q.Sort, "-")
+	sortColumn, ok := sortColumns[key]
+	if !ok {
+		return nil, errorf(ErrInvalid, "unknown sort %q", q.Sort)
+	}
+	descending := strings.HasPrefix(q.Sort, "-")
+
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.LocationID != 0 {
+		conditions = append(conditions, "location_id = "+arg(q.LocationID))
+	}
+	if len(q.Statuses) > 0 {
+		conditions = append(conditions, "status = ANY("+arg(pq.Array(q.Statuses))+")")
+	}
+	if q.Type != "" {
+		conditions = append(conditions, "order_type = "+arg(q.Type))
+	}
+	if q.TableNumber != 0 {
+		conditions = append(conditions, "table_number = "+arg(q.TableNumber))
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "order_time >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "order_time < "+arg(q.To))
+	}
+	if q.MenuItemID != 0 {
+		conditions = append(conditions, "items @> "+arg(fmt.Sprintf(`[{"ItemID": %d}]`, q.MenuItemID))+"::jsonb")
+	}
+	if q.MinTotal != nil {
+		conditions = append(conditions, "COALESCE(total_amount, 0) >= "+arg(*q.MinTotal))
+	}
+	if q.MaxTotal != nil {
+		conditions = append(conditions, "COALESCE(total_amount, 0) <= "+arg(*q.MaxTotal))
+	}
+	if !q.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != q.Sort {
+			return nil, errorf(ErrInvalid, "invalid cursor")
+		}
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			sortColumn.column, op, arg(c.Value), sortColumn.cast, arg(c.ID)))
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+
+	query := "SELECT " + orderColumns + " FROM orders"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", sortColumn.column, direction, direction, arg(q.Limit+1))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &OrderPage{Orders: []Order{}}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Orders = append(page.Orders, *order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Orders) > q.Limit {
+		page.Orders = page.Orders[:q.Limit]
+		last := page.Orders[len(page.Orders)-1]
+		page.NextCursor = encodeCursor(cursor{Sort: q.Sort, Value: sortValue(key, last), ID: last.ID})
+	}
+
+	return page, nil
+}
+
+func (p *Postgres) OpenTableOrders(ctx context.Context, location, tableNumber int) ([]Order, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT `+orderColumns+` FROM orders
+		 WHERE location_id = $1 AND table_number = $2 AND status NOT IN ('Completed', 'Cancelled') AND deleted_at IS NULL
+		 ORDER BY order_time`,
+		location, tableNumber,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders, rows.Err()
+}
+
+func (p *Postgres) AmendOrder(ctx context.Context, id int, items []OrderItem, notes, actor string) (*Order, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var location int
+	var orderType string
+	var itemsJSON []byte
+	var status string
+	var existingNotes sql.NullString
+	var previousTotal, discount money.Money
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT location_id, order_type, items, status, notes, COALESCE(total_amount, 0), discount_amount
+		 FROM orders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		id,
+	).Scan(&location, &orderType, &itemsJSON, &status, &existingNotes, &previousTotal, &discount)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if Closed(status) {
+		return nil, errorf(ErrOrderClosed, "order %d is %s and can no longer be amended", id, status)
+	}
+
+	items, err = menuLines(ctx, tx, location, items)
+	if err != nil {
+		return nil, err
+	}
+
+	var allItems []OrderItem
+	if err := json.Unmarshal(itemsJSON, &allItems); err != nil {
+		return nil, err
+	}
+	allItems = append(allItems, items...)
+
+	totals, err := priceOrder(ctx, tx, location, orderType, allItems)
+	if err != nil {
+		return nil, err
+	}
+	total := totals.Total.Sub(discount)
+
+	if err := adjustStock(ctx, tx, location, items, -1); err != nil {
+		return nil, err
+	}
+
+	itemsJSON, err = json.Marshal(allItems)
+	if err != nil {
+		return nil, err
+	}
+	taxJSON, err := json.Marshal(totals.TaxBreakdown)
+	if err != nil {
+		return nil, err
+	}
+
+	notes = appendNotes(existingNotes.String, notes)
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE orders
+		 SET items = $1, total_amount = $2, tax_amount = $3, tax_breakdown = $4, notes = $5, version = version + 1
+		 WHERE id = $6`,
+		itemsJSON, total, totals.TaxAmount, taxJSON, notes, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO notifications (order_id, location_id, notification_type, message) VALUES ($1, $2, $3, $4)",
+		id, location, "order_amended", fmt.Sprintf("%d item(s) added to order #%d", len(items), id),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordEvent(ctx, tx, id, EventAmended, actor,
+		map[string]interface{}{"TotalAmount": previousTotal, "Notes": existingNotes.String},
+		map[string]interface{}{"TotalAmount": total, "Notes": notes, "AddedItems": items},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := enqueueOrderEvent(ctx, tx, id, events.OrderAmended)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, tx.Commit()
+}
+
+func (p *Postgres) UpdateStatus(ctx context.Context, id int, status string, chefID, expectedVersion int, actor string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var location int
+	var orderType, previousStatus string
+	var assignedToID int
+	var version int
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT location_id, order_type, status, COALESCE(assigned_staff_id, 0), version
+		 FROM orders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		id,
+	).Scan(&location, &orderType, &previousStatus, &assignedToID, &version)
+	if err == sql.ErrNoRows {
+		return errorf(ErrNotFound, "order with ID %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(id, expectedVersion, version); err != nil {
+		return err
+	}
+	// Closing an order has already settled its stock, payments, table and points
+	if Closed(previousStatus) {
+		return errorf(ErrOrderClosed, "order %d is %s and its status can no longer be changed", id, previousStatus)
+	}
+	if err := checkStatus(orderType, previousStatus, status); err != nil {
+		return err
+	}
+
+	// An unassigned order goes to the chef working on it; staff who are not chefs here
+	// move it without taking it
+	if chefID != 0 && assignedToID == 0 {
+		name, err := chefAt(ctx, tx, location, chefID)
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			return err
+		}
+		if err == nil {
+			if err := assignChef(ctx, tx, id, 0, "", chefID, name, actor); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE orders SET status = $1, version = version + 1 WHERE id = $2",
+		status, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	// If completed, update table status to Available
+	if status == "Completed" {
+		var tableNumber int
+		err = tx.QueryRowContext(
+			ctx,
+			`UPDATE tables t
+			 SET status = 'Available'
+			 FROM orders o
+			 WHERE o.id = $1 AND t.location_id = o.location_id AND t.number = o.table_number
+			 RETURNING t.number`,
+			id,
+		).Scan(&tableNumber)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			if err := enqueueTableEvent(ctx, tx, location, tableNumber, "Available"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Record notification for status change
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO notifications (order_id, location_id, notification_type, message) VALUES ($1, $2, $3, $4)",
+		id, location, "status_change", fmt.Sprintf("Order #%d status changed to %s", id, status),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordEvent(ctx, tx, id, EventStatusChanged, actor,
+		map[string]interface{}{"Status": previousStatus},
+		map[string]interface{}{"Status": status},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := enqueueOrderEvent(ctx, tx, id, events.OrderStatusChanged); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgres) AssignOrder(ctx context.Context, id, staffID int, actor string) (*Order, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var location int
+	var status string
+	var itemsJSON []byte
+	var previousID int
+	var previousName sql.NullString
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT location_id, status, items, COALESCE(assigned_staff_id, 0), assigned_to
+		 FROM orders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		id,
+	).Scan(&location, &status, &itemsJSON, &previousID, &previousName)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if Closed(status) {
+		return nil, errorf(ErrOrderClosed, "order %d is %s and can no longer be assigned", id, status)
+	}
+
+	var name string
+	if staffID == 0 {
+		var items []OrderItem
+		if err := json.Unmarshal(itemsJSON, &items); err != nil {
+			return nil, err
+		}
+		staffID, name, err = chooseChef(ctx, tx, location, items)
+		if err != nil {
+			return nil, err
+		}
+		if staffID == 0 {
+			return nil, errorf(ErrInvalid, "no chef at location %d can cook order %d", location, id)
+		}
+	} else {
+		name, err = chefAt(ctx, tx, location, staffID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := assignChef(ctx, tx, id, previousID, previousName.String, staffID, name, actor); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO notifications (order_id, location_id, notification_type, message) VALUES ($1, $2, $3, $4)",
+		id, location, "order_assigned", fmt.Sprintf("Order #%d assigned to %s", id, name),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := enqueueOrderEvent(ctx, tx, id, events.OrderAssigned)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, tx.Commit()
+}
+
+func (p *Postgres) CancelOrder(ctx context.Context, id int, reason string, confirmed bool, actor string) (*Order, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var location int
+	var status string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT location_id, status FROM orders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	).Scan(&location, &status)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "order %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCancellable(id, status, confirmed); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE orders SET status = 'Cancelled', cancel_reason = $1, cancelled_time = NOW(), version = version + 1 WHERE id = $2",
+		reason, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO notifications (order_id, location_id, notification_type, message) VALUES ($1, $2, $3, $4)",
+		id, location, "order_cancelled", fmt.Sprintf("Order #%d cancelled (was %s): %s", id, status, reason),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordEvent(ctx, tx, id, EventCancelled, actor,
+		map[string]interface{}{"Status": status},
+		map[string]interface{}{"Status": "Cancelled", "Reason": reason, "Confirmed": confirmed},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cancellation alert carries the reason for the kitchen
+	order, err := enqueueOrderEvent(ctx, tx, id, events.OrderCancelled)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, tx.Commit()
+}
+
+// RestoreInventory flags the order so that a retried call does not restore the stock twice
+func (p *Postgres) RestoreInventory(ctx context.Context, id int) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var location int
+	var itemsJSON []byte
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE orders SET stock_restored = TRUE WHERE id = $1 AND NOT stock_restored RETURNING location_id, items",
+		id,
+	).Scan(&location, &itemsJSON)
+	if err == sql.ErrNoRows {
+		return nil // Already restored
+	}
+	if err != nil {
+		return err
+	}
+
+	var items []OrderItem
+	if err := json.Unmarshal(itemsJSON, &items); err != nil {
+		return err
+	}
+
+	if err := adjustStock(ctx, tx, location, items, 1); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteOrder keeps the order in the database, with its notifications and history,
+// until the purge job removes it after the retention period
+func (p *Postgres) DeleteOrder(ctx context.Context, id int, reason string, expectedVersion int, actor string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var version int
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT status, version FROM orders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	).Scan(&status, &version)
+	if err == sql.ErrNoRows {
+		return errorf(ErrNotFound, "order %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(id, expectedVersion, version); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE orders SET deleted_at = NOW(), deleted_by = $1, delete_reason = $2, version = version + 1
+		 WHERE id = $3`,
+		actor, reason, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordEvent(ctx, tx, id, EventDeleted, actor,
+		map[string]interface{}{"Deleted": false},
+		map[string]interface{}{"Deleted": true, "Reason": reason, "OrderStatus": status},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Screens showing the order drop it, and reports leave it out from now on
+	if _, err := enqueueOrderEvent(ctx, tx, id, events.OrderDeleted); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgres) RestoreOrder(ctx context.Context, id int, actor string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedBy, deleteReason sql.NullString
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT deleted_by, delete_reason FROM orders WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE",
+		id,
+	).Scan(&deletedBy, &deleteReason)
+	if err == sql.ErrNoRows {
+		return errorf(ErrNotFound, "deleted order %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE orders SET deleted_at = NULL, deleted_by = NULL, delete_reason = NULL, version = version + 1 WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordEvent(ctx, tx, id, EventRestored, actor,
+		map[string]interface{}{"Deleted": true, "DeletedBy": deletedBy.String, "Reason": deleteReason.String},
+		map[string]interface{}{"Deleted": false},
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// History is read from order_events, which outlive the order when it is purged. The
+// order row is only needed for orders from before the event log.
+func (p *Postgres) History(ctx context.Context, id int) (*OrderHistory, error) {
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT id, location_id, event_type, actor, occurred_at, previous, current
+		 FROM order_events WHERE order_id = $1 ORDER BY occurred_at, id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var location int
+	var orderEvents []OrderEvent
+	for rows.Next() {
+		event := OrderEvent{OrderID: id}
+		var previous, current []byte
+		if err := rows.Scan(&event.ID, &location, &event.Type, &event.Actor, &event.OccurredAt, &previous, &current); err != nil {
+			return nil, err
+		}
+		event.Previous = previous
+		event.Current = current
+		orderEvents = append(orderEvents, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var orderTime time.Time
+	if len(orderEvents) == 0 || orderEvents[0].Type != EventCreated {
+		err := p.db.QueryRowContext(ctx, "SELECT location_id, order_time FROM orders WHERE id = $1", id).Scan(&location, &orderTime)
+		if err == sql.ErrNoRows && len(orderEvents) == 0 {
+			return nil, errorf(ErrNotFound, "order %d not found", id)
+		}
+		if err == sql.ErrNoRows {
+			orderTime = orderEvents[0].OccurredAt
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return newHistory(id, location, orderTime, orderEvents, time.Now()), nil
+}
+
+// appendNotes adds the notes of an amendment to the order's existing notes
+func appendNotes(existing, notes string) string {
+	if existing != "" && notes != "" {
+		return existing + "; " + notes
+	}
+	if notes == "" {
+		return existing
+	}
+	return notes
+}
+
+// checkCancellable fails when an order in this status cannot be cancelled, or not
+// without confirmation
+func checkCancellable(id int, status string, confirmed bool) error {
+	if Closed(status) {
+		return errorf(ErrOrderClosed, "order %d is already %s", id, status)
+	}
+	if KitchenStarted(status) && !confirmed {
+		return errorf(ErrConfirmationRequired, "order %d is %s in the kitchen, cancelling it must be confirmed", id, status)
+	}
+	return nil
+}
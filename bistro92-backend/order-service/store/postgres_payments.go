@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+func (p *Postgres) RecordPayment(ctx context.Context, payment Payment, actor string) (*Payment, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var total, paid money.Money
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT o.status, COALESCE(o.total_amount, 0),
+		        COALESCE((SELECT SUM(amount) FROM payments p WHERE p.order_id = o.id AND p.status = 'Captured'), 0)
+		 FROM orders o WHERE o.id = $1 AND o.deleted_at IS NULL FOR UPDATE OF o`,
+		payment.OrderID,
+	).Scan(&status, &total, &paid)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "order %d not found", payment.OrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status == "Cancelled" {
+		return nil, errorf(ErrOrderClosed, "order %d is cancelled and cannot be paid", payment.OrderID)
+	}
+
+	payment, err = preparePayment(payment, total, paid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO payments (order_id, amount, method, status)
+		 VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		payment.OrderID, payment.Amount, payment.Method, payment.Status,
+	).Scan(&payment.ID, &payment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, current := paymentEvent(payment, paid)
+	if err := recordEvent(ctx, tx, payment.OrderID, EventPaid, actor, previous, current); err != nil {
+		return nil, err
+	}
+
+	return &payment, tx.Commit()
+}
+
+func (p *Postgres) VoidPendingPayments(ctx context.Context, orderID int) (int, error) {
+	result, err := p.db.ExecContext(
+		ctx,
+		"UPDATE payments SET status = 'Voided', voided_at = NOW() WHERE order_id = $1 AND status = 'Pending'",
+		orderID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	voided, err := result.RowsAffected()
+	return int(voided), err
+}
+
+// preparePayment fills in the defaults: without an amount the outstanding balance is
+// charged, and payments are captured unless stated otherwise. Payments are taken in
+// the order's currency.
+func preparePayment(payment Payment, total, paid money.Money) (Payment, error) {
+	if payment.Amount.IsZero() {
+		payment.Amount = total.Sub(paid)
+	}
+	if !payment.Amount.SameCurrency(total) {
+		return payment, errorf(ErrInvalid, "order %d is paid in %s, not %s", payment.OrderID, total.Currency, payment.Amount.Currency)
+	}
+	if payment.Status == "" {
+		payment.Status = PaymentCaptured
+	}
+	return payment, nil
+}
+
+// paymentEvent is the history entry for a payment, given what was paid before it
+func paymentEvent(payment Payment, paid money.Money) (previous, current map[string]interface{}) {
+	return map[string]interface{}{"PaidAmount": paid},
+		map[string]interface{}{
+			"PaymentID": payment.ID,
+			"Amount":    payment.Amount,
+			"Method":    payment.Method,
+			// Not "Status", which the history reads as the order's status
+			"PaymentStatus": payment.Status,
+			"PaidAmount":    paid.Add(payment.Amount),
+		}
+}
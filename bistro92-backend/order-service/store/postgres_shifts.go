@@ -0,0 +1,339 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// shiftColumns is the column list read by scanShift, from shifts sh joined with staff s
+const shiftColumns = `sh.id, sh.staff_id, s.name, sh.location_id, COALESCE(sh.section, ''),
+	sh.scheduled_start, sh.scheduled_end, sh.clock_in, sh.clock_out`
+
+func scanShift(row interface{ Scan(...interface{}) error }) (*Shift, error) {
+	var shift Shift
+	var scheduledStart, scheduledEnd, clockIn, clockOut sql.NullTime
+	err := row.Scan(&shift.ID, &shift.StaffID, &shift.StaffName, &shift.LocationID, &shift.Section,
+		&scheduledStart, &scheduledEnd, &clockIn, &clockOut)
+	if err != nil {
+		return nil, err
+	}
+	if scheduledStart.Valid {
+		shift.ScheduledStart = &scheduledStart.Time
+	}
+	if scheduledEnd.Valid {
+		shift.ScheduledEnd = &scheduledEnd.Time
+	}
+	if clockIn.Valid {
+		shift.ClockIn = &clockIn.Time
+	}
+	if clockOut.Valid {
+		shift.ClockOut = &clockOut.Time
+	}
+	shift.Breaks = []Break{}
+	return &shift, nil
+}
+
+// loadBreaks fills in the breaks of the shifts
+func (p *Postgres) loadBreaks(ctx context.Context, shifts []Shift) error {
+	if len(shifts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(shifts))
+	byID := make(map[int]*Shift, len(shifts))
+	for i := range shifts {
+		ids[i] = int64(shifts[i].ID)
+		byID[shifts[i].ID] = &shifts[i]
+	}
+
+	rows, err := p.db.QueryContext(
+		ctx,
+		"SELECT shift_id, started_at, ended_at FROM shift_breaks WHERE shift_id = ANY($1) ORDER BY started_at, id",
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shiftID int
+		var b Break
+		var endedAt sql.NullTime
+		if err := rows.Scan(&shiftID, &b.StartedAt, &endedAt); err != nil {
+			return err
+		}
+		if endedAt.Valid {
+			b.EndedAt = &endedAt.Time
+		}
+		byID[shiftID].Breaks = append(byID[shiftID].Breaks, b)
+	}
+	return rows.Err()
+}
+
+func (p *Postgres) ListShifts(ctx context.Context, location int, from, to time.Time, staffID int) ([]Shift, error) {
+	// A shift lasts from when it was clocked into, or is scheduled to start, until it was
+	// clocked out of, or is scheduled to end; a shift under way has not ended yet
+	rows, err := p.db.QueryContext(
+		ctx,
+		`SELECT `+shiftColumns+`
+		 FROM shifts sh JOIN staff s ON s.id = sh.staff_id
+		 WHERE sh.location_id = $1 AND ($4 = 0 OR sh.staff_id = $4)
+		   AND COALESCE(sh.clock_in, sh.scheduled_start) < $3
+		   AND CASE WHEN sh.clock_in IS NULL THEN sh.scheduled_end ELSE COALESCE(sh.clock_out, 'infinity') END > $2
+		 ORDER BY COALESCE(sh.clock_in, sh.scheduled_start), sh.id`,
+		location, from, to, staffID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shifts := []Shift{}
+	for rows.Next() {
+		shift, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, *shift)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shifts, p.loadBreaks(ctx, shifts)
+}
+
+// GetShift returns a shift with its breaks
+func (p *Postgres) GetShift(ctx context.Context, id int) (*Shift, error) {
+	shift, err := scanShift(p.db.QueryRowContext(
+		ctx,
+		"SELECT "+shiftColumns+" FROM shifts sh JOIN staff s ON s.id = sh.staff_id WHERE sh.id = $1",
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "shift %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shifts := []Shift{*shift}
+	if err := p.loadBreaks(ctx, shifts); err != nil {
+		return nil, err
+	}
+	return &shifts[0], nil
+}
+
+func (p *Postgres) ScheduleShift(ctx context.Context, shift Shift) (*Shift, error) {
+	if shift.ScheduledStart == nil || shift.ScheduledEnd == nil || !shift.ScheduledEnd.After(*shift.ScheduledStart) {
+		return nil, errorf(ErrInvalid, "a shift must end after it starts")
+	}
+
+	var staffLocation int
+	err := p.db.QueryRowContext(ctx, "SELECT location_id FROM staff WHERE id = $1", shift.StaffID).Scan(&staffLocation)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrInvalid, "staff member %d not found", shift.StaffID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if staffLocation != shift.LocationID {
+		return nil, errorf(ErrInvalid, "staff member %d does not work at location %d", shift.StaffID, shift.LocationID)
+	}
+
+	var id int
+	err = p.db.QueryRowContext(
+		ctx,
+		`INSERT INTO shifts (staff_id, location_id, section, scheduled_start, scheduled_end)
+		 VALUES ($1, $2, NULLIF($3, ''), $4, $5) RETURNING id`,
+		shift.StaffID, shift.LocationID, shift.Section, *shift.ScheduledStart, *shift.ScheduledEnd,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
+
+func (p *Postgres) DeleteShift(ctx context.Context, id int) error {
+	var clockedIn bool
+	err := p.db.QueryRowContext(ctx, "SELECT clock_in IS NOT NULL FROM shifts WHERE id = $1", id).Scan(&clockedIn)
+	if err == sql.ErrNoRows {
+		return errorf(ErrNotFound, "shift %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if clockedIn {
+		return errorf(ErrInvalid, "shift %d has been clocked into and is kept for the labor report", id)
+	}
+
+	_, err = p.db.ExecContext(ctx, "DELETE FROM shifts WHERE id = $1 AND clock_in IS NULL", id)
+	return err
+}
+
+func (p *Postgres) CurrentShift(ctx context.Context, staffID int) (*Shift, error) {
+	var id int
+	err := p.db.QueryRowContext(
+		ctx,
+		"SELECT id FROM shifts WHERE staff_id = $1 AND clock_in IS NOT NULL AND clock_out IS NULL",
+		staffID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "staff member %d is not clocked in", staffID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
+
+func (p *Postgres) ClockIn(ctx context.Context, staffID, location int, section string) (*Shift, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Start the scheduled shift that is under way or about to start, if any
+	var id int
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT id FROM shifts
+		 WHERE staff_id = $1 AND location_id = $2 AND clock_in IS NULL
+		   AND scheduled_start <= NOW() + make_interval(secs => $3) AND scheduled_end > NOW()
+		 ORDER BY scheduled_start
+		 LIMIT 1
+		 FOR UPDATE`,
+		staffID, location, ShiftClockInWindow.Seconds(),
+	).Scan(&id)
+	switch err {
+	case nil:
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE shifts SET clock_in = NOW(), section = COALESCE(NULLIF($2, ''), section) WHERE id = $1",
+			id, section,
+		)
+	case sql.ErrNoRows:
+		err = tx.QueryRowContext(
+			ctx,
+			"INSERT INTO shifts (staff_id, location_id, section, clock_in) VALUES ($1, $2, NULLIF($3, ''), NOW()) RETURNING id",
+			staffID, location, section,
+		).Scan(&id)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation of idx_shifts_open
+		return nil, errorf(ErrExists, "staff member %d is already clocked in", staffID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
+
+// openShift locks the shift the staff member is clocked into and returns its ID
+func openShift(ctx context.Context, tx *sql.Tx, staffID int) (int, error) {
+	var id int
+	err := tx.QueryRowContext(
+		ctx,
+		"SELECT id FROM shifts WHERE staff_id = $1 AND clock_in IS NOT NULL AND clock_out IS NULL FOR UPDATE",
+		staffID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errorf(ErrNotFound, "staff member %d is not clocked in", staffID)
+	}
+	return id, err
+}
+
+func (p *Postgres) ClockOut(ctx context.Context, staffID int) (*Shift, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := openShift(ctx, tx, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE shift_breaks SET ended_at = NOW() WHERE shift_id = $1 AND ended_at IS NULL", id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE shifts SET clock_out = NOW() WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
+
+func (p *Postgres) StartBreak(ctx context.Context, staffID int) (*Shift, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := openShift(ctx, tx, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO shift_breaks (shift_id)
+		 SELECT $1 WHERE NOT EXISTS (SELECT 1 FROM shift_breaks WHERE shift_id = $1 AND ended_at IS NULL)`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errorf(ErrExists, "staff member %d is already on a break", staffID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
+
+func (p *Postgres) EndBreak(ctx context.Context, staffID int) (*Shift, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := openShift(ctx, tx, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, "UPDATE shift_breaks SET ended_at = NOW() WHERE shift_id = $1 AND ended_at IS NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, errorf(ErrNotFound, "staff member %d is not on a break", staffID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetShift(ctx, id)
+}
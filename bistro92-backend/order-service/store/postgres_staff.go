@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const staffColumns = "id, username, name, role, location_id, COALESCE(station, ''), active, created_at, password_hash"
+
+func scanStaff(row interface{ Scan(...interface{}) error }) (*Staff, error) {
+	var staff Staff
+	err := row.Scan(&staff.ID, &staff.Username, &staff.Name, &staff.Role, &staff.LocationID, &staff.Station, &staff.Active, &staff.CreatedAt,
+		&staff.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func (p *Postgres) ListStaff(ctx context.Context, location int) ([]Staff, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT "+staffColumns+" FROM staff WHERE location_id = $1 ORDER BY username", location)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := []Staff{}
+	for rows.Next() {
+		member, err := scanStaff(rows)
+		if err != nil {
+			return nil, err
+		}
+		staff = append(staff, *member)
+	}
+	return staff, rows.Err()
+}
+
+func (p *Postgres) GetStaff(ctx context.Context, id int) (*Staff, error) {
+	staff, err := scanStaff(p.db.QueryRowContext(ctx, "SELECT "+staffColumns+" FROM staff WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "staff member %d not found", id)
+	}
+	return staff, err
+}
+
+func (p *Postgres) StaffByUsername(ctx context.Context, username string) (*Staff, error) {
+	staff, err := scanStaff(p.db.QueryRowContext(ctx, "SELECT "+staffColumns+" FROM staff WHERE username = $1", username))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "staff member %q not found", username)
+	}
+	return staff, err
+}
+
+func (p *Postgres) CreateStaff(ctx context.Context, staff Staff) (*Staff, error) {
+	err := p.db.QueryRowContext(
+		ctx,
+		`INSERT INTO staff (username, name, role, location_id, station, password_hash, active)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7) RETURNING id, created_at`,
+		staff.Username, staff.Name, staff.Role, staff.LocationID, staff.Station, staff.PasswordHash, staff.Active,
+	).Scan(&staff.ID, &staff.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return nil, errorf(ErrExists, "username %q is taken", staff.Username)
+	}
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return nil, errorf(ErrNotFound, "location %d not found", staff.LocationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func (p *Postgres) UpdateStaff(ctx context.Context, staff Staff) (*Staff, error) {
+	updated, err := scanStaff(p.db.QueryRowContext(
+		ctx,
+		`UPDATE staff SET name = $2, role = $3, location_id = $4, station = NULLIF($5, ''), active = $6,
+		     password_hash = COALESCE(NULLIF($7, ''), password_hash)
+		 WHERE id = $1 RETURNING `+staffColumns,
+		staff.ID, staff.Name, staff.Role, staff.LocationID, staff.Station, staff.Active, staff.PasswordHash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "staff member %d not found", staff.ID)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return nil, errorf(ErrNotFound, "location %d not found", staff.LocationID)
+	}
+	return updated, err
+}
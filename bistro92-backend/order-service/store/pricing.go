@@ -0,0 +1,136 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+// TaxRate is the tax configured for a menu category
+type TaxRate struct {
+	Category  string
+	OrderType string // Only for orders of this type, e.g. a lower rate for takeaway; every type when empty
+	Name      string
+	Rate      float64
+	Inclusive bool // Menu prices already include the tax
+}
+
+// taxKey identifies a tax rate: its category and the order type it is for
+type taxKey struct {
+	category  string
+	orderType string
+}
+
+// rateFor returns the tax rate of a menu category for orders of the type: the rate
+// configured for that type, or else the rate for every type
+func rateFor(rates map[taxKey]TaxRate, category, orderType string) (TaxRate, bool) {
+	if orderType == "" {
+		orderType = OrderDineIn
+	}
+	if rate, ok := rates[taxKey{category, orderType}]; ok {
+		return rate, true
+	}
+	rate, ok := rates[taxKey{category, ""}]
+	return rate, ok
+}
+
+// TaxLine is the tax charged for one category on an order
+type TaxLine struct {
+	Category  string
+	Name      string
+	Rate      float64
+	Inclusive bool
+	Taxable   money.Money // Net amount the rate was applied to
+	Tax       money.Money
+}
+
+// orderTotals is what the guest is charged for a set of items
+type orderTotals struct {
+	Total        money.Money
+	TaxAmount    money.Money
+	TaxBreakdown []TaxLine
+}
+
+// PriceFromMenu returns the order lines with the name and price of their menu item,
+// whatever the client sent. menu holds the items at the order's location keyed by ID;
+// a line for any other item is ErrInvalid.
+func PriceFromMenu(items []OrderItem, menu map[int]MenuItem) ([]OrderItem, error) {
+	priced := make([]OrderItem, len(items))
+	for i, item := range items {
+		menuItem, ok := menu[item.ItemID]
+		if !ok {
+			return nil, errorf(ErrInvalid, "menu item %d is not on the menu here", item.ItemID)
+		}
+		item.Name, item.Price = menuItem.Name, menuItem.Price
+		priced[i] = item
+	}
+	return priced, nil
+}
+
+// priceItems calculates the total and the tax breakdown for the items of an order, with
+// the tax rate of each menu item keyed by item ID. Exclusive tax is added on top of the
+// item prices, inclusive tax is only reported.
+func priceItems(items []OrderItem, rates map[int]TaxRate) orderTotals {
+	var subtotal money.Money
+	for _, item := range items {
+		subtotal = subtotal.Add(item.Price.Mul(item.Quantity))
+	}
+
+	taxBreakdown, exclusiveTax := calculateTax(items, rates)
+
+	var taxAmount money.Money
+	for _, line := range taxBreakdown {
+		taxAmount = taxAmount.Add(line.Tax)
+	}
+
+	return orderTotals{
+		Total:        subtotal.Add(exclusiveTax),
+		TaxAmount:    taxAmount,
+		TaxBreakdown: taxBreakdown,
+	}
+}
+
+// calculateTax builds the per-category tax breakdown for the items. It also returns the
+// tax that has to be added on top of the item prices, i.e. the exclusive part only.
+// Tax is rounded once per category rather than per item.
+func calculateTax(items []OrderItem, rates map[int]TaxRate) ([]TaxLine, money.Money) {
+	lines := make(map[string]*TaxLine)
+	gross := make(map[string]money.Money)
+	for _, item := range items {
+		rate, ok := rates[item.ItemID]
+		if !ok {
+			continue
+		}
+
+		line, ok := lines[rate.Category]
+		if !ok {
+			line = &TaxLine{
+				Category:  rate.Category,
+				Name:      rate.Name,
+				Rate:      rate.Rate,
+				Inclusive: rate.Inclusive,
+			}
+			lines[rate.Category] = line
+		}
+		gross[rate.Category] = gross[rate.Category].Add(item.Price.Mul(item.Quantity))
+	}
+
+	breakdown := make([]TaxLine, 0, len(lines))
+	var exclusiveTax money.Money
+	for category, line := range lines {
+		if line.Inclusive {
+			line.Taxable = gross[category].Scale(1 / (1 + line.Rate))
+			line.Tax = gross[category].Sub(line.Taxable)
+		} else {
+			line.Taxable = gross[category]
+			line.Tax = gross[category].Scale(line.Rate)
+			exclusiveTax = exclusiveTax.Add(line.Tax)
+		}
+		breakdown = append(breakdown, *line)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		return breakdown[i].Category < breakdown[j].Category
+	})
+
+	return breakdown, exclusiveTax
+}
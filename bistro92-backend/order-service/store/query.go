@@ -0,0 +1,96 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+	DefaultSort     = "-order_time"
+)
+
+// sortKeys are the sort keys accepted by ListOrders
+var sortKeys = map[string]bool{"order_time": true, "total_amount": true, "table_number": true}
+
+// OrderQuery filters, sorts and pages the order list. Zero values mean "no filter".
+type OrderQuery struct {
+	LocationID     int
+	Statuses       []string
+	Type           string // Order type
+	TableNumber    int
+	From, To       time.Time // order_time range, To is exclusive
+	MenuItemID     int       // Orders containing this menu item
+	MinTotal       *money.Money
+	MaxTotal       *money.Money
+	Sort           string // Sort key, prefixed with "-" for descending
+	Limit          int
+	Cursor         string // NextCursor of the previous page
+	IncludeDeleted bool
+}
+
+// OrderPage is one page of orders. NextCursor is empty on the last page.
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// ValidSort reports whether the sort key is supported
+func ValidSort(sort string) bool {
+	return sortKeys[strings.TrimPrefix(sort, "-")]
+}
+
+// normalize fills in the defaults and caps the page size
+func (q *OrderQuery) normalize() {
+	if q.Sort == "" {
+		q.Sort = DefaultSort
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+}
+
+// cursor marks the last row of a page. It carries the sort it was made for, so that
+// it cannot be replayed against a different ordering.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// sortValue formats the order's value for the sort key the way the Postgres cursor
+// condition casts it back
+func sortValue(key string, order Order) string {
+	switch key {
+	case "total_amount":
+		return order.TotalAmount.Decimal()
+	case "table_number":
+		return strconv.Itoa(order.TableNumber)
+	default:
+		return order.OrderTime.Format("2006-01-02 15:04:05.999999")
+	}
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
@@ -0,0 +1,475 @@
+// Package store holds the order service's domain types and the repositories that
+// persist them. Postgres is the production implementation; Memory keeps everything in
+// process, so that the order flow can run without a database.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+// Errors returned by the repositories. They are wrapped with details, so compare
+// them with errors.Is.
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrInvalid              = errors.New("invalid")
+	ErrOrderClosed          = errors.New("order is closed")
+	ErrConfirmationRequired = errors.New("confirmation required")
+	ErrVersionMismatch      = errors.New("version mismatch")
+	ErrExists               = errors.New("already exists")
+)
+
+// storeError is an error with a message for the caller that matches one of the
+// errors above
+type storeError struct {
+	msg  string
+	kind error
+}
+
+func (e *storeError) Error() string { return e.msg }
+func (e *storeError) Unwrap() error { return e.kind }
+
+func errorf(kind error, format string, args ...interface{}) error {
+	return &storeError{msg: fmt.Sprintf(format, args...), kind: kind}
+}
+
+// checkVersion fails when an expected version is given and the order is no longer at it
+func checkVersion(orderID, expected, current int) error {
+	if expected == 0 || expected == current {
+		return nil
+	}
+	return errorf(ErrVersionMismatch, "order %d is at version %d, not %d", orderID, current, expected)
+}
+
+// Location is one of the restaurants. Menu items, tables, orders, staff and devices
+// each belong to one location; IDs are unique across all of them.
+type Location struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Phone     string    `json:"phone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MenuItem struct {
+	ID         int         `json:"id"`
+	LocationID int         `json:"locationId"`
+	Name       string      `json:"name"`
+	Price      money.Money `json:"price"`
+	Category   string      `json:"category"`
+	PrepTime   int         `json:"prepTime"`
+	ImageURL   string      `json:"imageUrl"`
+	Station    string      `json:"station"`
+	Stock      *int        `json:"stock,omitempty"` // Portions left, nil when stock is not tracked
+}
+
+// Table is a table of a location; table numbers are unique within a location
+type Table struct {
+	LocationID int    `json:"locationId"`
+	Number     int    `json:"number"`
+	Status     string `json:"status"`
+	Capacity   int    `json:"capacity"`
+	Section    string `json:"section,omitempty"` // The part of the floor the table is in
+	// CodeVersion is signed into the table's QR code; rotating the code increments it
+	CodeVersion int `json:"codeVersion"`
+}
+
+type Order struct {
+	ID           int
+	LocationID   int    // Set from the table's location when the order is created
+	Type         string `binding:"omitempty,oneof=dine-in takeaway delivery"` // Dine-in when empty
+	TableNumber  int    // 0 for takeaway and delivery orders
+	Items        []OrderItem
+	Status       string
+	AssignedToID int    `json:",omitempty"` // The chef cooking the order, 0 while unassigned
+	AssignedTo   string `json:",omitempty"` // The chef's name
+	HandledByID  int    `json:",omitempty"` // The clocked-in staff member who took the order
+	HandledBy    string `json:",omitempty"` // Their name
+
+	// The guest collecting loyalty points for the order, 0 without one, and the points
+	// they redeemed on it. Discount is what the redeemed points took off the total.
+	CustomerID     int `json:",omitempty"`
+	PointsRedeemed int `json:",omitempty" binding:"min=0"`
+	Discount       money.Money
+	WorkflowID     string `json:",omitempty"` // The OrderWorkflow that placed the order
+
+	// Who takeaway and delivery orders are handed to, when a takeaway order is collected
+	// (as soon as it is ready when nil) and where a delivery order goes
+	CustomerName    string     `json:",omitempty" binding:"max=100"`
+	CustomerPhone   string     `json:",omitempty" binding:"max=30"`
+	PickupTime      *time.Time `json:",omitempty"`
+	DeliveryAddress string     `json:",omitempty" binding:"max=255"`
+
+	OrderTime    time.Time
+	TotalAmount  money.Money
+	TaxAmount    money.Money
+	TaxBreakdown []TaxLine
+	Notes        string
+	CancelReason string
+	DeletedAt    *time.Time `json:",omitempty"`
+	DeletedBy    string     `json:",omitempty"`
+	DeleteReason string     `json:",omitempty"`
+	Version      int        // Incremented on every change, sent as the ETag
+}
+
+type OrderItem struct {
+	ItemID   int
+	Name     string
+	Quantity int
+	Price    money.Money // Also decodes the plain float prices of older orders
+	Course   int         // 0 when the item is not part of a coursed meal
+	Notes    string
+}
+
+// Staff is an account staff log in with. PasswordHash is a bcrypt hash and never
+// leaves the service.
+type Staff struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	LocationID   int       `json:"location_id"`       // Where the staff member works
+	Station      string    `json:"station,omitempty"` // The station a chef cooks at, empty for any
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+	PasswordHash string    `json:"-"`
+}
+
+// Device is a table terminal. It signs its requests with Secret, which is only shown
+// when the device is registered or its secret is rotated, and orders for its table.
+type Device struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	LocationID  int        `json:"location_id"`
+	TableNumber int        `json:"table_number"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"` // Revoked devices are refused
+	Secret      string     `json:"-"`
+}
+
+// Shift is a staff member's shift at a location. Shifts are scheduled ahead, or started
+// by clocking in without a schedule, in which case they have no scheduled times.
+type Shift struct {
+	ID             int        `json:"id"`
+	StaffID        int        `json:"staff_id"`
+	StaffName      string     `json:"staff_name"`
+	LocationID     int        `json:"location_id"`
+	Section        string     `json:"section,omitempty"` // The floor section worked, empty for all of it
+	ScheduledStart *time.Time `json:"scheduled_start,omitempty"`
+	ScheduledEnd   *time.Time `json:"scheduled_end,omitempty"`
+	ClockIn        *time.Time `json:"clock_in,omitempty"`
+	ClockOut       *time.Time `json:"clock_out,omitempty"`
+	Breaks         []Break    `json:"breaks"`
+}
+
+// Break is an unpaid break taken during a shift
+type Break struct {
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"` // nil while the break is under way
+}
+
+// Customer is a guest who collects loyalty points. Customers are shared by every
+// location and identified by phone number or email address, at least one of which is
+// set; both are unique.
+type Customer struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Points    int       `json:"points"` // The balance that can be redeemed
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Kinds of loyalty transactions
+const (
+	PointsEarned   = "earned"
+	PointsRedeemed = "redeemed"
+	PointsReversed = "reversed" // Undoes what a cancelled order earned and redeemed
+)
+
+// LoyaltyTransaction is a change to a customer's points balance made by an order
+type LoyaltyTransaction struct {
+	ID         int       `json:"id"`
+	CustomerID int       `json:"customer_id"`
+	OrderID    int       `json:"order_id"`
+	Kind       string    `json:"kind"`
+	Points     int       `json:"points"` // Negative when taken off the balance
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Loyalty points are earned on the total paid for completed orders, and are worth a
+// fixed amount when redeemed
+const (
+	PointsPerUnit = 1 // Earned per whole unit of currency, e.g. per dollar
+	PointValue    = 1 // Minor units taken off an order per point redeemed, e.g. a cent
+)
+
+// PointsFor returns the points a completed order with this total earns
+func PointsFor(total money.Money) int {
+	if total.Amount <= 0 {
+		return 0
+	}
+	return int(total.Amount/100) * PointsPerUnit
+}
+
+// Payment statuses
+const (
+	PaymentPending  = "Pending"  // Authorised but not captured yet, e.g. a card pre-authorisation
+	PaymentCaptured = "Captured" // Money taken
+	PaymentVoided   = "Voided"
+)
+
+type Payment struct {
+	ID        int
+	OrderID   int
+	Amount    money.Money
+	Method    string
+	Status    string
+	CreatedAt time.Time
+}
+
+// ShiftClockInWindow is how early staff may clock into a scheduled shift
+const ShiftClockInWindow = time.Hour
+
+// Order types
+const (
+	OrderDineIn   = "dine-in"
+	OrderTakeaway = "takeaway"
+	OrderDelivery = "delivery"
+)
+
+// statusFlows are the statuses orders of each type go through, one step at a time.
+// Cancelled is possible in every status before Completed, through CancelOrder.
+var statusFlows = map[string][]string{
+	OrderDineIn:   {"Pending", "In Progress", "Ready", "Completed"},
+	OrderTakeaway: {"Pending", "In Progress", "Ready for Pickup", "Completed"},
+	OrderDelivery: {"Pending", "In Progress", "Ready", "Out for Delivery", "Completed"},
+}
+
+// StatusFlow returns the statuses an order of the type goes through, in order, or nil
+// for an unknown type
+func StatusFlow(orderType string) []string {
+	if orderType == "" {
+		orderType = OrderDineIn
+	}
+	return statusFlows[orderType]
+}
+
+// NextStatus returns the status that follows the given one in the flow of the order
+// type, or "" when there is none
+func NextStatus(orderType, status string) string {
+	flow := StatusFlow(orderType)
+	for i, s := range flow {
+		if s == status && i+1 < len(flow) {
+			return flow[i+1]
+		}
+	}
+	return ""
+}
+
+// CanMove reports whether an order of the type can go from one status to the other:
+// to the next status of its flow, or to Cancelled while it is open
+func CanMove(orderType, from, to string) bool {
+	if Closed(from) {
+		return false
+	}
+	return to == "Cancelled" || to != "" && to == NextStatus(orderType, from)
+}
+
+// checkStatus returns ErrInvalid when an order of the type cannot be moved from one
+// status to the other by a status change; cancelling goes through CancelOrder
+func checkStatus(orderType, from, to string) error {
+	if to == "Cancelled" {
+		return errorf(ErrInvalid, "orders are cancelled with a reason, not by a status change")
+	}
+	if CanMove(orderType, from, to) {
+		return nil
+	}
+	if orderType == "" {
+		orderType = OrderDineIn
+	}
+	next := NextStatus(orderType, from)
+	if next == "" {
+		return errorf(ErrInvalid, "%s orders go through %s; %s is the last status", orderType, strings.Join(StatusFlow(orderType), ", "), from)
+	}
+	return errorf(ErrInvalid, "%s orders go through %s; this one is %s and can only move on to %s",
+		orderType, strings.Join(StatusFlow(orderType), ", "), from, next)
+}
+
+// KitchenStarted reports whether the kitchen is already working on an order in this
+// status, in which case cancelling it needs an explicit confirmation.
+func KitchenStarted(status string) bool {
+	switch status {
+	case "In Progress", "Ready", "Ready for Pickup", "Out for Delivery":
+		return true
+	}
+	return false
+}
+
+// Closed reports whether an order in this status can no longer change
+func Closed(status string) bool {
+	return status == "Completed" || status == "Cancelled"
+}
+
+type LocationRepository interface {
+	ListLocations(ctx context.Context) ([]Location, error)
+	GetLocation(ctx context.Context, id int) (*Location, error)
+	CreateLocation(ctx context.Context, location Location) (*Location, error)
+}
+
+// MenuRepository reads the menu of a location. Items of other locations are not found.
+type MenuRepository interface {
+	ListMenuItems(ctx context.Context, location int) ([]MenuItem, error)
+	GetMenuItem(ctx context.Context, location, id int) (*MenuItem, error)
+	// MenuItemsByID returns the requested items that exist at the location, keyed by ID
+	MenuItemsByID(ctx context.Context, location int, ids []int) (map[int]MenuItem, error)
+}
+
+type TableRepository interface {
+	ListTables(ctx context.Context, location int) ([]Table, error)
+	GetTable(ctx context.Context, location, number int) (*Table, error)
+	// RotateTableCode increments the table's CodeVersion, so that the QR codes printed
+	// before stop working
+	RotateTableCode(ctx context.Context, location, number int) (*Table, error)
+	// ReleaseTableIfLastOpen makes the order's table available again when no other
+	// order on it is still open. It reports whether the table was released.
+	ReleaseTableIfLastOpen(ctx context.Context, orderID int) (bool, error)
+}
+
+// OrderRepository stores orders. Every change is recorded in the order's history and
+// announced as an event, together with the change itself. When expectedVersion is not
+// 0 the change only applies if the order is still at that version. Orders are looked
+// up by ID whatever their location; callers check LocationID.
+type OrderRepository interface {
+	// CreateOrder prices and stores a new order at its LocationID, occupies its table,
+	// takes its items out of stock and assigns it to the least busy chef, if any. The
+	// staff member placing it, HandledByID, is recorded as handling it when they are
+	// clocked in; orders without one, e.g. from table devices, go to a server clocked
+	// into the table's section. With a CustomerID the order is linked to the customer,
+	// and PointsRedeemed are taken off their balance and off the total. ref identifies
+	// the request: the workflow ID, kept as WorkflowID, which links the order to the
+	// Idempotency-Key the request came with.
+	CreateOrder(ctx context.Context, order Order, actor, ref string) (int, error)
+	GetOrder(ctx context.Context, id int) (*Order, error)
+	ListOrders(ctx context.Context, query OrderQuery) (*OrderPage, error)
+	// OpenTableOrders returns the orders on a table that are still open, i.e. the
+	// table's current bill, oldest first.
+	OpenTableOrders(ctx context.Context, location, tableNumber int) ([]Order, error)
+	// AmendOrder adds items to an open order and reprices it
+	AmendOrder(ctx context.Context, id int, items []OrderItem, notes, actor string) (*Order, error)
+	// UpdateStatus moves an order to a new status. When chefID is not 0 and the order
+	// is not assigned yet, it is assigned to that chef, e.g. the chef starting on it.
+	UpdateStatus(ctx context.Context, id int, status string, chefID, expectedVersion int, actor string) error
+	// AssignOrder assigns an open order to an active chef at its location. With staffID
+	// 0 the least busy chef is chosen: the one with the fewest Pending and In Progress
+	// orders among those cooking at one of the order's stations or at any station.
+	AssignOrder(ctx context.Context, id, staffID int, actor string) (*Order, error)
+	// CancelOrder marks an order cancelled. Once the kitchen has started on it the
+	// cancellation must be confirmed.
+	CancelOrder(ctx context.Context, id int, reason string, confirmed bool, actor string) (*Order, error)
+	// RestoreInventory puts a cancelled order's items back into stock, once
+	RestoreInventory(ctx context.Context, id int) error
+	// DeleteOrder soft-deletes an order; RestoreOrder undoes it
+	DeleteOrder(ctx context.Context, id int, reason string, expectedVersion int, actor string) error
+	RestoreOrder(ctx context.Context, id int, actor string) error
+	History(ctx context.Context, id int) (*OrderHistory, error)
+}
+
+type PaymentRepository interface {
+	// RecordPayment stores a payment against an order. Without an amount the order's
+	// outstanding balance is charged.
+	RecordPayment(ctx context.Context, payment Payment, actor string) (*Payment, error)
+	// VoidPendingPayments voids the order's payments that have not been captured yet
+	// and returns how many were voided.
+	VoidPendingPayments(ctx context.Context, orderID int) (int, error)
+}
+
+type StaffRepository interface {
+	// ListStaff returns the accounts of the staff working at the location
+	ListStaff(ctx context.Context, location int) ([]Staff, error)
+	GetStaff(ctx context.Context, id int) (*Staff, error)
+	// StaffByUsername finds the account to log in with, including inactive ones
+	StaffByUsername(ctx context.Context, username string) (*Staff, error)
+	// CreateStaff stores a new account. Usernames are unique.
+	CreateStaff(ctx context.Context, staff Staff) (*Staff, error)
+	// UpdateStaff changes an account's name, role, location, station and active flag,
+	// and its password when PasswordHash is set
+	UpdateStaff(ctx context.Context, staff Staff) (*Staff, error)
+}
+
+// ShiftRepository schedules shifts and records when staff clock in and out and take
+// breaks. A staff member has at most one shift under way.
+type ShiftRepository interface {
+	// ListShifts returns the shifts at the location that are scheduled or worked between
+	// from and to, of one staff member when staffID is not 0
+	ListShifts(ctx context.Context, location int, from, to time.Time, staffID int) ([]Shift, error)
+	GetShift(ctx context.Context, id int) (*Shift, error)
+	// ScheduleShift plans a shift for a staff member of its location
+	ScheduleShift(ctx context.Context, shift Shift) (*Shift, error)
+	// DeleteShift removes a scheduled shift that has not been clocked into
+	DeleteShift(ctx context.Context, id int) error
+	// CurrentShift returns the shift the staff member is clocked into
+	CurrentShift(ctx context.Context, staffID int) (*Shift, error)
+	// ClockIn starts the staff member's shift at the location: the scheduled shift that
+	// is under way or starts within ShiftClockInWindow, or else an unscheduled one. A
+	// section overrides the scheduled one.
+	ClockIn(ctx context.Context, staffID, location int, section string) (*Shift, error)
+	// ClockOut ends the shift under way, and its break if the staff member is on one
+	ClockOut(ctx context.Context, staffID int) (*Shift, error)
+	StartBreak(ctx context.Context, staffID int) (*Shift, error)
+	EndBreak(ctx context.Context, staffID int) (*Shift, error)
+}
+
+// CustomerRepository keeps customer profiles and their loyalty points. Points change
+// through orders: redeemed when an order is created, earned once it is completed and
+// reversed when it is cancelled. Each happens once per order, whatever the retries.
+type CustomerRepository interface {
+	// ListCustomers returns the customers whose phone number or email address is
+	// search, or whose name contains it; every customer when search is empty
+	ListCustomers(ctx context.Context, search string) ([]Customer, error)
+	GetCustomer(ctx context.Context, id int) (*Customer, error)
+	// CreateCustomer stores a new customer without points
+	CreateCustomer(ctx context.Context, customer Customer) (*Customer, error)
+	// UpdateCustomer changes a customer's name, phone number and email address
+	UpdateCustomer(ctx context.Context, customer Customer) (*Customer, error)
+	// LoyaltyHistory returns the customer's loyalty transactions, newest first
+	LoyaltyHistory(ctx context.Context, customerID int) ([]LoyaltyTransaction, error)
+	// AwardPoints credits the order's customer with the points for its total, if the
+	// order is completed and was not reversed. It returns the points credited.
+	AwardPoints(ctx context.Context, orderID int) (int, error)
+	// ReversePoints takes back the points the order earned and gives back the points
+	// redeemed on it. It returns the change to the customer's balance.
+	ReversePoints(ctx context.Context, orderID int) (int, error)
+}
+
+type DeviceRepository interface {
+	ListDevices(ctx context.Context, location int) ([]Device, error)
+	// GetDevice returns the device including its secret, also when it is revoked
+	GetDevice(ctx context.Context, id string) (*Device, error)
+	// CreateDevice registers a device for an existing table of its location
+	CreateDevice(ctx context.Context, device Device) (*Device, error)
+	// RotateDeviceSecret replaces the secret of a device that is not revoked; the old
+	// secret stops working at once
+	RotateDeviceSecret(ctx context.Context, id, secret string) (*Device, error)
+	// RevokeDevice stops the device from being accepted, for good
+	RevokeDevice(ctx context.Context, id string) (*Device, error)
+}
+
+// Repositories bundles the repositories of one implementation
+type Repositories struct {
+	Locations LocationRepository
+	Menu      MenuRepository
+	Tables    TableRepository
+	Orders    OrderRepository
+	Payments  PaymentRepository
+	Staff     StaffRepository
+	Devices   DeviceRepository
+	Shifts    ShiftRepository
+	Customers CustomerRepository
+}
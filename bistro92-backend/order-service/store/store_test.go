@@ -0,0 +1,82 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bistro92/backend/common/money"
+)
+
+func TestCanMove(t *testing.T) {
+	tests := []struct {
+		orderType, from, to string
+		want                bool
+	}{
+		{"", "Pending", "In Progress", true},
+		{OrderDineIn, "Pending", "In Progress", true},
+		{OrderDineIn, "In Progress", "Ready", true},
+		{OrderDineIn, "Ready", "Completed", true},
+		{OrderDineIn, "Pending", "Completed", false},
+		{OrderDineIn, "Ready", "In Progress", false},
+		{OrderDineIn, "Ready", "Ready for Pickup", false},
+		{OrderDineIn, "Pending", "Pending", false},
+
+		{OrderTakeaway, "Pending", "In Progress", true},
+		{OrderTakeaway, "In Progress", "Ready for Pickup", true},
+		{OrderTakeaway, "Ready for Pickup", "Completed", true},
+		{OrderTakeaway, "In Progress", "Ready", false},
+		{OrderTakeaway, "Pending", "Ready for Pickup", false},
+
+		{OrderDelivery, "Pending", "In Progress", true},
+		{OrderDelivery, "In Progress", "Ready", true},
+		{OrderDelivery, "Ready", "Out for Delivery", true},
+		{OrderDelivery, "Out for Delivery", "Completed", true},
+		{OrderDelivery, "Pending", "Completed", false},
+		{OrderDelivery, "Out for Delivery", "In Progress", false},
+		{OrderDelivery, "Ready", "Completed", false},
+
+		{OrderTakeaway, "In Progress", "Cancelled", true},
+		{OrderDelivery, "Out for Delivery", "Cancelled", true},
+		{OrderDineIn, "Completed", "Cancelled", false},
+		{OrderDineIn, "Cancelled", "Pending", false},
+		{"pizza", "Pending", "In Progress", false},
+	}
+	for _, tt := range tests {
+		if got := CanMove(tt.orderType, tt.from, tt.to); got != tt.want {
+			t.Errorf("CanMove(%q, %q, %q) = %v, want %v", tt.orderType, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	order := Order{
+		ID:          42,
+		TableNumber: 7,
+		TotalAmount: money.New(2375, money.DefaultCurrency),
+		OrderTime:   time.Date(2024, 3, 9, 18, 30, 5, 123456000, time.UTC),
+	}
+	for _, sort := range []string{"order_time", "-order_time", "total_amount", "-total_amount", "table_number", "-table_number"} {
+		key := sort
+		if key[0] == '-' {
+			key = key[1:]
+		}
+		c := cursor{Sort: sort, Value: sortValue(key, order), ID: order.ID}
+
+		decoded, err := decodeCursor(encodeCursor(c))
+		if err != nil {
+			t.Fatalf("%s: decodeCursor: %v", sort, err)
+		}
+		if decoded != c {
+			t.Errorf("%s: decoded %+v, want %+v", sort, decoded, c)
+		}
+
+		// The cursor's order compares equal to the one it was made from
+		after, err := cursorOrder(key, decoded)
+		if err != nil {
+			t.Fatalf("%s: cursorOrder: %v", sort, err)
+		}
+		if compareOrders(key, *after, order) != 0 {
+			t.Errorf("%s: cursor order %+v does not compare equal to %+v", sort, after, order)
+		}
+	}
+}
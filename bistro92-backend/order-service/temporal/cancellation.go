@@ -0,0 +1,34 @@
+package temporal
+
+import (
+	"context"
+
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// CancelOrder marks the order as cancelled with the given reason and returns it.
+// The compensating activities below undo the rest of the order's side effects.
+func CancelOrder(ctx context.Context, orderID int, reason string, confirmed bool, actor string) (*store.Order, error) {
+	order, err := repos.Orders.CancelOrder(ctx, orderID, reason, confirmed, actor)
+	return order, activityError(err)
+}
+
+// RestoreInventory puts the items of a cancelled order back into stock. A retried
+// activity does not restore the stock twice.
+func RestoreInventory(ctx context.Context, orderID int) error {
+	return activityError(repos.Orders.RestoreInventory(ctx, orderID))
+}
+
+// VoidPendingPayments voids payments on the order that have not been captured yet and
+// returns how many were voided.
+func VoidPendingPayments(ctx context.Context, orderID int) (int, error) {
+	voided, err := repos.Payments.VoidPendingPayments(ctx, orderID)
+	return voided, activityError(err)
+}
+
+// ReleaseTableIfLastOpen makes the order's table available again when no other order
+// on it is still open. It reports whether the table was released.
+func ReleaseTableIfLastOpen(ctx context.Context, orderID int) (bool, error) {
+	released, err := repos.Tables.ReleaseTableIfLastOpen(ctx, orderID)
+	return released, activityError(err)
+}
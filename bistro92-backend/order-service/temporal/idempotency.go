@@ -0,0 +1,134 @@
+package temporal
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyRetention is how long an Idempotency-Key is remembered. A retry after that
+// is treated as a new request.
+var IdempotencyRetention = 24 * time.Hour
+
+// IdempotencyScope is who an Idempotency-Key belongs to. Keys are chosen by clients,
+// so the same key from another caller or location is a different request.
+type IdempotencyScope struct {
+	LocationID int
+	Caller     string // e.g. "staff:12", "device:<id>" or "table:4"
+}
+
+// IdempotencyRecord is a remembered Idempotency-Key. OrderID is set once the order has
+// been stored and Response once the first request has been answered.
+type IdempotencyRecord struct {
+	Scope       IdempotencyScope
+	Key         string
+	RequestHash string
+	WorkflowID  string
+	OrderID     int
+	Response    json.RawMessage
+	CreatedAt   time.Time
+}
+
+// OrderWorkflowID derives the workflow ID for an order submitted with an Idempotency-Key,
+// so that retries of the same request map onto the same workflow
+func OrderWorkflowID(scope IdempotencyScope, key string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", scope.LocationID, scope.Caller, key)))
+	return "order-" + hex.EncodeToString(sum[:16])
+}
+
+// HashRequest fingerprints a request body, to detect a key being reused for a different request
+func HashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimIdempotencyKey records the key for a new request. It returns true if the caller now
+// owns the key, or false together with the remembered record if the key was already used
+// within the retention period. An expired key is taken over by the new request.
+func ClaimIdempotencyKey(ctx context.Context, scope IdempotencyScope, key, requestHash, workflowID string) (*IdempotencyRecord, bool, error) {
+	cutoff := time.Now().Add(-IdempotencyRetention)
+
+	result, err := db.ExecContext(
+		ctx,
+		`INSERT INTO idempotency_keys (location_id, caller, key, request_hash, workflow_id)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (location_id, caller, key) DO UPDATE
+		 SET request_hash = EXCLUDED.request_hash,
+		     workflow_id = EXCLUDED.workflow_id,
+		     order_id = NULL,
+		     response = NULL,
+		     created_at = CURRENT_TIMESTAMP
+		 WHERE idempotency_keys.created_at < $6`,
+		scope.LocationID, scope.Caller, key, requestHash, workflowID, cutoff,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 1 {
+		return nil, err == nil, err
+	}
+
+	record, err := GetIdempotencyKey(ctx, scope, key)
+	return record, false, err
+}
+
+// GetIdempotencyKey returns the remembered record for a key
+func GetIdempotencyKey(ctx context.Context, scope IdempotencyScope, key string) (*IdempotencyRecord, error) {
+	var record IdempotencyRecord
+	var orderID sql.NullInt64
+	var response []byte
+	err := db.QueryRowContext(
+		ctx,
+		`SELECT location_id, caller, key, request_hash, workflow_id, order_id, response, created_at
+		 FROM idempotency_keys WHERE location_id = $1 AND caller = $2 AND key = $3`,
+		scope.LocationID, scope.Caller, key,
+	).Scan(&record.Scope.LocationID, &record.Scope.Caller, &record.Key, &record.RequestHash, &record.WorkflowID, &orderID, &response, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	record.OrderID = int(orderID.Int64)
+	record.Response = response
+	return &record, nil
+}
+
+// SaveIdempotentResponse stores the response to the request that claimed the key
+func SaveIdempotentResponse(ctx context.Context, scope IdempotencyScope, key string, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(
+		ctx,
+		"UPDATE idempotency_keys SET response = $1 WHERE location_id = $2 AND caller = $3 AND key = $4",
+		data, scope.LocationID, scope.Caller, key,
+	)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a key whose request failed, so that it can be retried
+func ReleaseIdempotencyKey(ctx context.Context, scope IdempotencyScope, key string) error {
+	_, err := db.ExecContext(
+		ctx,
+		"DELETE FROM idempotency_keys WHERE location_id = $1 AND caller = $2 AND key = $3 AND order_id IS NULL",
+		scope.LocationID, scope.Caller, key,
+	)
+	return err
+}
+
+// PurgeIdempotencyKeys removes keys past the retention period
+func PurgeIdempotencyKeys(ctx context.Context) (int, error) {
+	result, err := db.ExecContext(
+		ctx,
+		"DELETE FROM idempotency_keys WHERE created_at < $1",
+		time.Now().Add(-IdempotencyRetention),
+	)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
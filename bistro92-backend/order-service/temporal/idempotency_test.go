@@ -0,0 +1,24 @@
+package temporal
+
+import "testing"
+
+func TestOrderWorkflowIDIsScoped(t *testing.T) {
+	scope := IdempotencyScope{LocationID: 1, Caller: "staff:4"}
+	if OrderWorkflowID(scope, "retry-1") != OrderWorkflowID(scope, "retry-1") {
+		t.Fatal("the same key and scope give different workflow IDs")
+	}
+
+	ids := map[string]IdempotencyScope{}
+	for _, other := range []IdempotencyScope{
+		scope,
+		{LocationID: 2, Caller: "staff:4"},
+		{LocationID: 1, Caller: "staff:5"},
+		{LocationID: 1, Caller: "device:4"},
+	} {
+		id := OrderWorkflowID(other, "retry-1")
+		if previous, ok := ids[id]; ok {
+			t.Errorf("%+v and %+v share workflow ID %s", previous, other, id)
+		}
+		ids[id] = other
+	}
+}
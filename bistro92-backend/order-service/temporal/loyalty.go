@@ -0,0 +1,91 @@
+package temporal
+
+import (
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// OrderClosedSignal tells an order's OrderWorkflow that the order was completed or
+// cancelled. It carries the status.
+const OrderClosedSignal = "order-closed"
+
+// loyaltyWindow is how long OrderWorkflow waits for a customer's order to close. Orders
+// completed later earn their points from UpdateOrderStatusWorkflow instead.
+const loyaltyWindow = 7 * 24 * time.Hour
+
+// AwardLoyaltyPoints credits the customer of a completed order with its points and
+// returns how many. Running it again credits nothing.
+func AwardLoyaltyPoints(ctx context.Context, orderID int) (int, error) {
+	points, err := repos.Customers.AwardPoints(ctx, orderID)
+	return points, activityError(err)
+}
+
+// ReverseLoyaltyPoints undoes what a cancelled order earned and redeemed, and returns
+// the change to the customer's balance. Running it again changes nothing.
+func ReverseLoyaltyPoints(ctx context.Context, orderID int) (int, error) {
+	points, err := repos.Customers.ReversePoints(ctx, orderID)
+	return points, activityError(err)
+}
+
+// awaitClosed waits in OrderWorkflow for the order to be completed, then credits the
+// customer with the order's points. Cancelled orders are settled by
+// CancelOrderWorkflow.
+func awaitClosed(ctx workflow.Context, orderID int) {
+	logger := workflow.GetLogger(ctx)
+
+	var status string
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, OrderClosedSignal), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, &status)
+	})
+	selector.AddFuture(workflow.NewTimer(timerCtx, loyaltyWindow), func(workflow.Future) {
+		logger.Info("Order still open, leaving its points to the status change", "order", orderID)
+	})
+	selector.Select(ctx)
+	cancelTimer()
+
+	if status == "Completed" {
+		awardPoints(ctx, orderID)
+	}
+}
+
+// awardPoints credits the order's customer, retrying for a while since the guest has
+// paid by now. A failure is logged but does not fail the workflow.
+func awardPoints(ctx workflow.Context, orderID int) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    10,
+		},
+	})
+
+	var points int
+	if err := workflow.ExecuteActivity(ctx, AwardLoyaltyPoints, orderID).Get(ctx, &points); err != nil {
+		workflow.GetLogger(ctx).Error("Failed to award loyalty points", "order", orderID, "error", err)
+		return
+	}
+	workflow.GetLogger(ctx).Info("Awarded loyalty points", "order", orderID, "points", points)
+}
+
+// signalOrderClosed tells the OrderWorkflow of a customer's order that it closed. It
+// reports whether the workflow got the signal, i.e. was still waiting for it.
+func signalOrderClosed(ctx workflow.Context, order store.Order, status string) bool {
+	if order.CustomerID == 0 || order.WorkflowID == "" {
+		return false
+	}
+	err := workflow.SignalExternalWorkflow(ctx, order.WorkflowID, "", OrderClosedSignal, status).Get(ctx, nil)
+	if err != nil {
+		workflow.GetLogger(ctx).Info("Order workflow not waiting for the order to close", "order", order.ID, "error", err)
+		return false
+	}
+	return true
+}
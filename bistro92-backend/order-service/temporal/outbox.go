@@ -0,0 +1,149 @@
+package temporal
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/order-service/broker"
+)
+
+var publisher *broker.Publisher
+
+// InitPublisher sets up the RabbitMQ publisher used by the outbox relay
+func InitPublisher(url string) *broker.Publisher {
+	publisher = broker.NewPublisher(url, events.Exchange)
+	return publisher
+}
+
+// OutboxRetention is how long sent outbox messages are kept before the nightly purge
+const OutboxRetention = 7 * 24 * time.Hour
+
+// outboxBatchSize caps the messages published by one relay run
+const outboxBatchSize = 100
+
+// outboxLockID is the Postgres advisory lock held by the running relay. Only one relay
+// publishes at a time so that messages go out in the order they were written.
+const outboxLockID = 920035
+
+// RelayOutbox publishes unsent outbox messages to RabbitMQ, oldest first, and marks
+// them sent once the broker has confirmed them. A message confirmed just before a
+// crash is sent again on the next run, so consumers see every message at least once,
+// and can recognise repeats by the envelope ID. It returns the number of messages
+// sent, which is 0 when another relay is already running.
+func RelayOutbox(ctx context.Context) (int, error) {
+	if db == nil {
+		return 0, nil // In-memory repositories keep their own outbox
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockID).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id, routing_key, payload FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1",
+		outboxBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	type message struct {
+		id         int64
+		routingKey string
+		payload    []byte
+	}
+	var messages []message
+	for rows.Next() {
+		var m message
+		if err := rows.Scan(&m.id, &m.routingKey, &m.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	sent := 0
+	var publishErr error
+	for _, m := range messages {
+		if publishErr = publisher.Publish(ctx, m.routingKey, m.payload); publishErr != nil {
+			// Keep the order: stop at the first failure and retry it on the next run
+			_, err := tx.ExecContext(
+				ctx,
+				"UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2",
+				publishErr.Error(), m.id,
+			)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE outbox SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL WHERE id = $1",
+			m.id,
+		)
+		if err != nil {
+			return 0, err
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return sent, publishErr
+}
+
+// StartOutboxRelay relays the outbox every interval until the context is cancelled.
+// Workflows relay right after their own changes; this loop picks up whatever they
+// could not send, e.g. while RabbitMQ was down or after a crash.
+func StartOutboxRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sent, err := RelayOutbox(ctx); err != nil {
+				log.Printf("Outbox relay failed after %d message(s): %v", sent, err)
+			}
+		}
+	}
+}
+
+// PurgeSentOutbox removes sent messages past OutboxRetention
+func PurgeSentOutbox(ctx context.Context) (int, error) {
+	result, err := db.ExecContext(
+		ctx,
+		"DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1",
+		time.Now().Add(-OutboxRetention),
+	)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
@@ -0,0 +1,14 @@
+package temporal
+
+import (
+	"context"
+
+	"github.com/bistro92/backend/order-service/store"
+)
+
+// RecordPayment stores a payment against an order. Without an amount the order's
+// outstanding balance is charged.
+func RecordPayment(ctx context.Context, payment store.Payment, actor string) (*store.Payment, error) {
+	recorded, err := repos.Payments.RecordPayment(ctx, payment, actor)
+	return recorded, activityError(err)
+}
@@ -0,0 +1,121 @@
+package temporal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+
+	"github.com/bistro92/backend/common/events"
+	"github.com/bistro92/backend/order-service/store"
+	"github.com/bistro92/backend/order-service/ticket"
+)
+
+// DefaultStation receives the items whose menu entry has no station
+const DefaultStation = "kitchen"
+
+// kitchenPrinters maps each station to the address of its raw TCP (port 9100) printer.
+// It is configured as KITCHEN_PRINTERS="kitchen=10.0.0.20:9100,bar=10.0.0.21:9100".
+// Stations of other locations than the first are prefixed with the location ID, as in
+// "2/kitchen=10.0.1.20:9100".
+var kitchenPrinters = parsePrinters(os.Getenv("KITCHEN_PRINTERS"))
+
+func parsePrinters(config string) map[string]string {
+	printers := make(map[string]string)
+	for _, entry := range strings.Split(config, ",") {
+		station, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && station != "" && addr != "" {
+			printers[station] = addr
+		}
+	}
+	return printers
+}
+
+// BuildKitchenTickets splits the items into one ticket per station. For an addition
+// only the added items should be passed in.
+func BuildKitchenTickets(ctx context.Context, order store.Order, items []store.OrderItem, kind ticket.Kind) ([]ticket.Ticket, error) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ItemID)
+	}
+
+	menuItems, err := repos.Menu.MenuItemsByID(ctx, order.LocationID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var tickets []ticket.Ticket
+	byStation := make(map[string]int)
+	for _, item := range items {
+		station := menuItems[item.ItemID].Station
+		if station == "" {
+			station = DefaultStation
+		}
+
+		i, ok := byStation[station]
+		if !ok {
+			tickets = append(tickets, ticket.Ticket{
+				Kind:        kind,
+				LocationID:  order.LocationID,
+				Station:     station,
+				OrderID:     order.ID,
+				TableNumber: order.TableNumber,
+				OrderType:   order.Type,
+				Customer:    order.CustomerName,
+				PickupTime:  order.PickupTime,
+				Chef:        order.AssignedTo,
+				Time:        time.Now(),
+				Notes:       order.Notes,
+				Reason:      order.CancelReason,
+			})
+			i = len(tickets) - 1
+			byStation[station] = i
+		}
+
+		tickets[i].Items = append(tickets[i].Items, ticket.Item{
+			Name:     item.Name,
+			Quantity: item.Quantity,
+			Course:   item.Course,
+			Notes:    item.Notes,
+		})
+	}
+
+	return tickets, nil
+}
+
+// PrintKitchenTicket sends the ticket to its station's printer. Connection and write
+// errors are returned so that Temporal retries the print; stations without a
+// configured printer are skipped.
+func PrintKitchenTicket(ctx context.Context, t ticket.Ticket) error {
+	addr, ok := kitchenPrinters[fmt.Sprintf("%d/%s", t.LocationID, t.Station)]
+	if !ok && t.LocationID == events.DefaultLocation {
+		addr, ok = kitchenPrinters[t.Station]
+	}
+	if !ok {
+		activity.GetLogger(ctx).Warn("No printer configured for station", "location", t.LocationID, "station", t.Station, "order", t.OrderID)
+		return nil
+	}
+
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("printer %s for station %s: %w", addr, t.Station, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(ticket.Render(t)); err != nil {
+		return fmt.Errorf("printer %s for station %s: %w", addr, t.Station, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package temporal
+
+import (
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// PurgeWorkflowID identifies the single scheduled purge workflow
+const PurgeWorkflowID = "purge-deleted-orders"
+
+// PurgeSchedule runs the purge every night, when the restaurant is closed
+const PurgeSchedule = "0 4 * * *"
+
+// PurgeDeletedOrdersWorkflow permanently removes orders that were soft-deleted longer
+// ago than the retention period, and clears out expired idempotency keys and sent
+// outbox messages. It is started with PurgeSchedule as its cron schedule.
+func PurgeDeletedOrdersWorkflow(ctx workflow.Context, retention time.Duration) (int, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
+	})
+
+	var purged int
+	err := workflow.ExecuteActivity(ctx, PurgeDeletedOrders, retention).Get(ctx, &purged)
+	if err != nil {
+		return 0, err
+	}
+
+	workflow.GetLogger(ctx).Info("Purged deleted orders", "count", purged, "retention", retention)
+
+	var keys int
+	if err := workflow.ExecuteActivity(ctx, PurgeIdempotencyKeys).Get(ctx, &keys); err != nil {
+		return purged, err
+	}
+	workflow.GetLogger(ctx).Info("Purged expired idempotency keys", "count", keys)
+
+	var messages int
+	if err := workflow.ExecuteActivity(ctx, PurgeSentOutbox).Get(ctx, &messages); err != nil {
+		return purged, err
+	}
+	workflow.GetLogger(ctx).Info("Purged sent outbox messages", "count", messages)
+
+	return purged, nil
+}
+
+// PurgeDeletedOrders hard-deletes soft-deleted orders past the retention period together
+// with their notifications and payments. Their order_events are kept as the audit trail.
+func PurgeDeletedOrders(ctx context.Context, retention time.Duration) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cutoff := time.Now().Add(-retention)
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM notifications WHERE order_id IN (
+		     SELECT id FROM orders WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		 )`,
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM payments WHERE order_id IN (
+		     SELECT id FROM orders WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		 )`,
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM orders WHERE deleted_at IS NOT NULL AND deleted_at < $1",
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), tx.Commit()
+}
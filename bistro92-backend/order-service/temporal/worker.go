@@ -11,14 +11,32 @@ func StartWorker(c client.Client) error {
 	// Register workflows
 	w.RegisterWorkflow(OrderWorkflow)
 	w.RegisterWorkflow(UpdateOrderStatusWorkflow)
+	w.RegisterWorkflow(AmendOrderWorkflow)
+	w.RegisterWorkflow(CancelOrderWorkflow)
+	w.RegisterWorkflow(RecordPaymentWorkflow)
+	w.RegisterWorkflow(PurgeDeletedOrdersWorkflow)
 
 	// Register activities
 	w.RegisterActivity(StoreOrder)
-	w.RegisterActivity(PublishOrderEvent)
+	w.RegisterActivity(RelayOutbox)
 	w.RegisterActivity(UpdateOrderStatus)
 	w.RegisterActivity(GetOrder)
-	w.RegisterActivity(GetOrders)
+	w.RegisterActivity(ListOrders)
 	w.RegisterActivity(DeleteOrder)
+	w.RegisterActivity(AmendOrder)
+	w.RegisterActivity(BuildKitchenTickets)
+	w.RegisterActivity(PrintKitchenTicket)
+	w.RegisterActivity(CancelOrder)
+	w.RegisterActivity(RestoreInventory)
+	w.RegisterActivity(VoidPendingPayments)
+	w.RegisterActivity(ReleaseTableIfLastOpen)
+	w.RegisterActivity(RecordPayment)
+	w.RegisterActivity(RestoreOrder)
+	w.RegisterActivity(AwardLoyaltyPoints)
+	w.RegisterActivity(ReverseLoyaltyPoints)
+	w.RegisterActivity(PurgeDeletedOrders)
+	w.RegisterActivity(PurgeIdempotencyKeys)
+	w.RegisterActivity(PurgeSentOutbox)
 
 	return w.Run(worker.InterruptCh())
 }
@@ -1,71 +1,211 @@
 package temporal
 
 import (
+	"errors"
 	"time"
 
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
-)
-
-type Order struct {
-	ID          int
-	TableNumber int
-	Items       []OrderItem
-	Status      string
-	OrderTime   time.Time
-}
 
-type OrderItem struct {
-	ItemID   int
-	Name     string
-	Quantity int
-	Price    float64
-}
+	"github.com/bistro92/backend/order-service/store"
+	"github.com/bistro92/backend/order-service/ticket"
+)
 
-func OrderWorkflow(ctx workflow.Context, order Order) error {
+func OrderWorkflow(ctx workflow.Context, order store.Order, actor string) error {
 	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute,
 		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
 	})
 
-	err := workflow.ExecuteActivity(ctx, StoreOrder, order).Get(ctx, nil)
+	err := workflow.ExecuteActivity(ctx, StoreOrder, order, actor).Get(ctx, &order.ID)
 	if err != nil {
 		return err
 	}
 
-	err = workflow.ExecuteActivity(ctx, PublishOrderEvent, order).Get(ctx, nil)
+	relayOutbox(ctx)
+
+	printKitchenTickets(ctx, order, order.Items, ticket.KindNew)
+
+	// A customer earns loyalty points once the order is completed
+	if order.CustomerID != 0 {
+		awaitClosed(ctx, order.ID)
+	}
+
+	return nil
+}
+
+// Amendment workflow, adds items to an open order
+func AmendOrderWorkflow(ctx workflow.Context, orderID int, items []store.OrderItem, notes string, actor string) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
+	})
+
+	var order *store.Order
+	err := workflow.ExecuteActivity(ctx, AmendOrder, orderID, items, notes, actor).Get(ctx, &order)
 	if err != nil {
 		return err
 	}
 
+	relayOutbox(ctx)
+
+	printKitchenTickets(ctx, *order, items, ticket.KindAddition)
+
 	return nil
 }
 
-// Status change workflow
-func UpdateOrderStatusWorkflow(ctx workflow.Context, orderID int, status string) error {
+// Cancellation workflow. Once the order is marked cancelled, every step the order took
+// is compensated; a failing step does not stop the others from running.
+func CancelOrderWorkflow(ctx workflow.Context, orderID int, reason string, confirmed bool, actor string) error {
 	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute,
 		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
 	})
+	logger := workflow.GetLogger(ctx)
 
-	// Update order status in database
-	err := workflow.ExecuteActivity(ctx, UpdateOrderStatus, orderID, status, "").Get(ctx, nil)
+	var order *store.Order
+	err := workflow.ExecuteActivity(ctx, CancelOrder, orderID, reason, confirmed, actor).Get(ctx, &order)
 	if err != nil {
 		return err
 	}
 
-	// Get the updated order to publish
-	var order *Order
-	err = workflow.ExecuteActivity(ctx, GetOrder, orderID).Get(ctx, &order)
+	// The kitchen alert was written to the outbox with the cancellation
+	relayOutbox(ctx)
+
+	// Compensations must eventually happen, so they are retried for longer
+	compensateCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    10,
+		},
+	})
+
+	var errs []error
+
+	if err := workflow.ExecuteActivity(compensateCtx, RestoreInventory, orderID).Get(ctx, nil); err != nil {
+		errs = append(errs, err)
+	}
+
+	var voided int
+	if err := workflow.ExecuteActivity(compensateCtx, VoidPendingPayments, orderID).Get(ctx, &voided); err != nil {
+		errs = append(errs, err)
+	}
+
+	var released bool
+	if err := workflow.ExecuteActivity(compensateCtx, ReleaseTableIfLastOpen, orderID).Get(ctx, &released); err != nil {
+		errs = append(errs, err)
+	}
+
+	if order.CustomerID != 0 {
+		var points int
+		if err := workflow.ExecuteActivity(compensateCtx, ReverseLoyaltyPoints, orderID).Get(ctx, &points); err != nil {
+			errs = append(errs, err)
+		}
+		signalOrderClosed(ctx, *order, "Cancelled")
+	}
+
+	printKitchenTickets(ctx, *order, order.Items, ticket.KindCancellation)
+
+	logger.Info("Order cancelled", "order", orderID, "payments_voided", voided, "table_released", released)
+	return errors.Join(errs...)
+}
+
+// Payment workflow, records a payment taken against an order
+func RecordPaymentWorkflow(ctx workflow.Context, payment store.Payment, actor string) (*store.Payment, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
+	})
+
+	var recorded *store.Payment
+	err := workflow.ExecuteActivity(ctx, RecordPayment, payment, actor).Get(ctx, &recorded)
+	return recorded, err
+}
+
+// printKitchenTickets prints a ticket for every station involved. Printers are often
+// offline for a while (paper out, power cycled), so prints are retried for several
+// minutes. A ticket that still fails is logged but does not fail the order, which is
+// already stored and shown on the kitchen screen.
+func printKitchenTickets(ctx workflow.Context, order store.Order, items []store.OrderItem, kind ticket.Kind) {
+	logger := workflow.GetLogger(ctx)
+
+	var tickets []ticket.Ticket
+	err := workflow.ExecuteActivity(ctx, BuildKitchenTickets, order, items, kind).Get(ctx, &tickets)
 	if err != nil {
-		return err
+		logger.Error("Failed to build kitchen tickets", "order", order.ID, "error", err)
+		return
+	}
+
+	printCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 30 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    2 * time.Second,
+			BackoffCoefficient: 2,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    10,
+		},
+	})
+
+	futures := make([]workflow.Future, len(tickets))
+	for i, t := range tickets {
+		futures[i] = workflow.ExecuteActivity(printCtx, PrintKitchenTicket, t)
+	}
+	for i, f := range futures {
+		if err := f.Get(ctx, nil); err != nil {
+			logger.Error("Failed to print kitchen ticket", "order", order.ID, "station", tickets[i].Station, "error", err)
+		}
 	}
+}
 
-	// Publish notification about status change
-	err = workflow.ExecuteActivity(ctx, PublishOrderEvent, *order).Get(ctx, nil)
+// Status change workflow
+func UpdateOrderStatusWorkflow(ctx workflow.Context, orderID int, status string, chefID, expectedVersion int, actor string) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 3},
+	})
+
+	// Update order status in database
+	err := workflow.ExecuteActivity(ctx, UpdateOrderStatus, orderID, status, chefID, expectedVersion, actor).Get(ctx, nil)
 	if err != nil {
 		return err
 	}
 
+	relayOutbox(ctx)
+
+	// The order's OrderWorkflow awards the customer's loyalty points; when it is no
+	// longer waiting for the order to close, they are awarded here. Awarding twice
+	// credits nothing.
+	if status == "Completed" {
+		var order *store.Order
+		if err := workflow.ExecuteActivity(ctx, GetOrder, orderID).Get(ctx, &order); err != nil {
+			workflow.GetLogger(ctx).Error("Failed to look up the completed order", "order", orderID, "error", err)
+			return nil
+		}
+		if order.CustomerID != 0 && !signalOrderClosed(ctx, *order, status) {
+			awardPoints(ctx, orderID)
+		}
+	}
+
 	return nil
 }
+
+// relayOutbox publishes the messages the workflow's change wrote to the outbox. The
+// relay fails when the broker nacks or does not confirm, and is retried a few times;
+// anything still unsent is picked up by the background relay.
+func relayOutbox(ctx workflow.Context) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 30 * time.Second,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2,
+			MaximumAttempts:    3,
+		},
+	})
+
+	if err := workflow.ExecuteActivity(ctx, RelayOutbox).Get(ctx, nil); err != nil {
+		workflow.GetLogger(ctx).Warn("Outbox relay failed, leaving it to the background relay", "error", err)
+	}
+}
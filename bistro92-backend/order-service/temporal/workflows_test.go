@@ -0,0 +1,230 @@
+package temporal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/bistro92/backend/common/money"
+	"github.com/bistro92/backend/order-service/store"
+)
+
+const testStock = 10
+
+// newTestEnv runs the workflows against a fresh in-memory store with one location, a
+// pizza with stock tracked and table 3
+func newTestEnv(t *testing.T) (*testsuite.TestWorkflowEnvironment, *store.Memory) {
+	t.Helper()
+	stock := testStock
+	memory := store.NewMemory(
+		[]store.Location{{ID: 1, Name: "Main"}},
+		[]store.MenuItem{{ID: 1, LocationID: 1, Name: "Pizza", Price: money.New(1099, money.DefaultCurrency), Category: "Food", Stock: &stock}},
+		[]store.TaxRate{{Category: "Food", Name: "VAT", Rate: 0.1}},
+		[]store.Table{{LocationID: 1, Number: 3, Status: "Available"}},
+	)
+	SetRepositories(memory.Repositories())
+	t.Cleanup(func() { SetRepositories(store.Repositories{}) })
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	for _, activity := range []interface{}{
+		StoreOrder, RelayOutbox, UpdateOrderStatus, GetOrder, AmendOrder, BuildKitchenTickets, PrintKitchenTicket,
+		CancelOrder, RestoreInventory, VoidPendingPayments, ReleaseTableIfLastOpen, AwardLoyaltyPoints, ReverseLoyaltyPoints,
+	} {
+		env.RegisterActivity(activity)
+	}
+	return env, memory
+}
+
+func testOrder() store.Order {
+	return store.Order{LocationID: 1, TableNumber: 3, Items: []store.OrderItem{{ItemID: 1, Quantity: 2}}}
+}
+
+// placeTestOrder stores an order directly, for the workflows that start from one
+func placeTestOrder(t *testing.T, memory *store.Memory, order store.Order) int {
+	t.Helper()
+	id, err := memory.CreateOrder(context.Background(), order, "test", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	return id
+}
+
+func assertStock(t *testing.T, memory *store.Memory, want int) {
+	t.Helper()
+	item, err := memory.GetMenuItem(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatalf("GetMenuItem: %v", err)
+	}
+	if *item.Stock != want {
+		t.Errorf("stock is %d, want %d", *item.Stock, want)
+	}
+}
+
+func assertTable(t *testing.T, memory *store.Memory, want string) {
+	t.Helper()
+	table, err := memory.GetTable(context.Background(), 1, 3)
+	if err != nil {
+		t.Fatalf("GetTable: %v", err)
+	}
+	if table.Status != want {
+		t.Errorf("table is %s, want %s", table.Status, want)
+	}
+}
+
+func assertStatus(t *testing.T, memory *store.Memory, id int, want string) {
+	t.Helper()
+	order, err := memory.GetOrder(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.Status != want {
+		t.Errorf("order is %s, want %s", order.Status, want)
+	}
+}
+
+func TestOrderWorkflow(t *testing.T) {
+	env, memory := newTestEnv(t)
+
+	env.ExecuteWorkflow(OrderWorkflow, testOrder(), "test")
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	order, err := memory.GetOrder(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.Status != "Pending" {
+		t.Errorf("order is %s, want Pending", order.Status)
+	}
+	// 2 pizzas at 10.99 plus 10% tax, priced from the menu
+	if want := money.New(2418, money.DefaultCurrency); order.TotalAmount != want {
+		t.Errorf("total is %s, want %s", order.TotalAmount, want)
+	}
+	assertStock(t, memory, testStock-2)
+	assertTable(t, memory, "Occupied")
+}
+
+func TestOrderWorkflowRefusesItemsNotOnTheMenu(t *testing.T) {
+	env, memory := newTestEnv(t)
+	order := testOrder()
+	order.Items = append(order.Items, store.OrderItem{ItemID: 99, Quantity: 1})
+
+	env.ExecuteWorkflow(OrderWorkflow, order, "test")
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != ErrTypeInvalid {
+		t.Fatalf("got %v, want an %s error", err, ErrTypeInvalid)
+	}
+	assertStock(t, memory, testStock)
+	assertTable(t, memory, "Available")
+}
+
+func TestCancelOrderWorkflow(t *testing.T) {
+	env, memory := newTestEnv(t)
+	id := placeTestOrder(t, memory, testOrder())
+	payment := store.Payment{OrderID: id, Method: "card", Status: store.PaymentPending}
+	if _, err := memory.RecordPayment(context.Background(), payment, "test"); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+	assertStock(t, memory, testStock-2)
+
+	env.ExecuteWorkflow(CancelOrderWorkflow, id, "Guest left", false, "test")
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, memory, id, "Cancelled")
+	assertStock(t, memory, testStock)
+	assertTable(t, memory, "Available")
+	// The pre-authorisation was voided, so there is nothing left to void
+	if voided, err := memory.VoidPendingPayments(context.Background(), id); err != nil || voided != 0 {
+		t.Errorf("%d payments still pending (%v)", voided, err)
+	}
+}
+
+func TestCancelOrderWorkflowNeedsConfirmationOnceCooking(t *testing.T) {
+	env, memory := newTestEnv(t)
+	id := placeTestOrder(t, memory, testOrder())
+	if err := memory.UpdateStatus(context.Background(), id, "In Progress", 0, 0, "test"); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	env.ExecuteWorkflow(CancelOrderWorkflow, id, "Guest left", false, "test")
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != ErrTypeConfirmationRequired {
+		t.Fatalf("got %v, want a %s error", err, ErrTypeConfirmationRequired)
+	}
+	assertStatus(t, memory, id, "In Progress")
+	assertStock(t, memory, testStock-2)
+	assertTable(t, memory, "Occupied")
+}
+
+func TestUpdateOrderStatusWorkflow(t *testing.T) {
+	_, memory := newTestEnv(t)
+	customer, err := memory.CreateCustomer(context.Background(), store.Customer{Name: "Maria Lopez", Phone: "555 0100"})
+	if err != nil {
+		t.Fatalf("CreateCustomer: %v", err)
+	}
+	order := testOrder()
+	order.CustomerID = customer.ID
+	order.WorkflowID = "order-1"
+	id := placeTestOrder(t, memory, order)
+
+	for _, status := range []string{"In Progress", "Ready", "Completed"} {
+		var suite testsuite.WorkflowTestSuite
+		env := suite.NewTestWorkflowEnvironment()
+		env.RegisterActivity(UpdateOrderStatus)
+		env.RegisterActivity(RelayOutbox)
+		env.RegisterActivity(GetOrder)
+		env.RegisterActivity(AwardLoyaltyPoints)
+		// The order's OrderWorkflow is no longer waiting, so the points are awarded here
+		env.OnSignalExternalWorkflow(mock.Anything, mock.Anything, mock.Anything, OrderClosedSignal, mock.Anything).
+			Return(errors.New("workflow not found"))
+
+		env.ExecuteWorkflow(UpdateOrderStatusWorkflow, id, status, 0, 0, "test")
+
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+		assertStatus(t, memory, id, status)
+		if status != "Completed" {
+			assertTable(t, memory, "Occupied")
+		}
+	}
+
+	assertTable(t, memory, "Available")
+	assertStock(t, memory, testStock-2)
+	customer, err = memory.GetCustomer(context.Background(), customer.ID)
+	if err != nil {
+		t.Fatalf("GetCustomer: %v", err)
+	}
+	if customer.Points == 0 {
+		t.Error("no loyalty points were awarded for the completed order")
+	}
+}
+
+func TestUpdateOrderStatusWorkflowRefusesClosedOrders(t *testing.T) {
+	env, memory := newTestEnv(t)
+	id := placeTestOrder(t, memory, testOrder())
+	if _, err := memory.CancelOrder(context.Background(), id, "Guest left", false, "test"); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	env.ExecuteWorkflow(UpdateOrderStatusWorkflow, id, "In Progress", 0, 0, "test")
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != ErrTypeOrderClosed {
+		t.Fatalf("got %v, want an %s error", err, ErrTypeOrderClosed)
+	}
+	assertStatus(t, memory, id, "Cancelled")
+}
@@ -0,0 +1,108 @@
+// Package ticket renders kitchen tickets for the station printers.
+package ticket
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bistro92/backend/order-service/escpos"
+)
+
+// Kind tells the station what to do with the items on a ticket
+type Kind string
+
+const (
+	KindNew          Kind = "new"
+	KindAddition     Kind = "addition"     // Only the items added to an existing order are listed
+	KindCancellation Kind = "cancellation" // The listed items must not be prepared
+)
+
+// Ticket is what one station needs to prepare its part of an order
+type Ticket struct {
+	Kind        Kind
+	LocationID  int
+	Station     string
+	OrderID     int
+	TableNumber int        // 0 for takeaway and delivery orders
+	OrderType   string     // Printed instead of the table for takeaway and delivery orders
+	Customer    string     // Who takeaway and delivery orders are handed to
+	PickupTime  *time.Time // When a takeaway order is collected, if the guest said
+	Chef        string     // The chef the order is assigned to, if any
+	Time        time.Time
+	Notes       string
+	Reason      string // Why the order was cancelled
+	Items       []Item
+}
+
+type Item struct {
+	Name     string
+	Quantity int
+	Course   int
+	Notes    string
+}
+
+// Render renders the ticket as an ESC/POS job. Items are grouped by course and the
+// table number, or TAKEAWAY or DELIVERY, is printed large so it can be read from
+// across the pass.
+func Render(t Ticket) []byte {
+	b := escpos.New()
+
+	b.Align(escpos.AlignCenter).Bold(true)
+	switch t.Kind {
+	case KindAddition:
+		b.Invert(true).Line(" ADDITION ").Invert(false)
+	case KindCancellation:
+		b.Invert(true).Size(2, 2).Line(" CANCELLED ").Size(1, 1).Invert(false)
+		b.Line("DO NOT PREPARE")
+	}
+	if t.TableNumber != 0 {
+		b.Size(2, 2).Line(fmt.Sprintf("TABLE %d", t.TableNumber)).Size(1, 1).Bold(false)
+	} else {
+		b.Size(2, 2).Line(strings.ToUpper(t.OrderType)).Size(1, 1).Bold(false)
+		b.Line(t.Customer)
+		if t.PickupTime != nil {
+			b.Bold(true).Line("Pickup " + t.PickupTime.Format("15:04")).Bold(false)
+		}
+	}
+	b.Line(fmt.Sprintf("Order #%d  %s", t.OrderID, t.Time.Format("15:04")))
+	b.Line(fmt.Sprintf("[%s]", t.Station))
+	if t.Chef != "" {
+		b.Line("Chef: " + t.Chef)
+	}
+
+	b.Align(escpos.AlignLeft).Line("------------------------------------------")
+
+	items := append([]Item(nil), t.Items...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Course < items[j].Course })
+
+	course := -1
+	for _, item := range items {
+		if item.Course != course && item.Course > 0 {
+			b.Bold(true).Line(fmt.Sprintf("-- Course %d --", item.Course)).Bold(false)
+		}
+		course = item.Course
+
+		line := fmt.Sprintf("%dx %s", item.Quantity, item.Name)
+		if t.Kind == KindCancellation {
+			line = "VOID " + line
+		}
+		b.Size(1, 2).Bold(true).Line(line).Bold(false).Size(1, 1)
+		if item.Notes != "" {
+			b.Line("   * " + item.Notes)
+		}
+	}
+
+	if t.Reason != "" {
+		b.Line("------------------------------------------")
+		b.Bold(true).Line("REASON: " + t.Reason).Bold(false)
+	}
+
+	if t.Notes != "" {
+		b.Line("------------------------------------------")
+		b.Bold(true).Line("NOTES: " + t.Notes).Bold(false)
+	}
+
+	return b.Feed(4).Cut().Bytes()
+}
@@ -1,6 +1,8 @@
 #include <Wire.h>
 #include <Adafruit_GFX.h>
 #include <Adafruit_SSD1306.h>
+#include <time.h>
+#include "mbedtls/md.h"
 
 // OLED setup
 #define SCREEN_WIDTH 128
@@ -18,8 +20,10 @@ Adafruit_SSD1306 display(SCREEN_WIDTH, SCREEN_HEIGHT, &Wire, OLED_RESET);
 #define BUTTON_3 14 // Scroll Up/Increment
 #define BUTTON_4 15 // Scroll Down/Decrement
 
-// Hardcoded table number
-#define TABLE_NUMBER 8
+// Device credentials from POST /devices (or /devices/:id/rotate). The order service
+// takes the table number from the device, so it is not configured here.
+#define DEVICE_ID "dev_0000000000000000"
+#define DEVICE_SECRET "replace-with-the-secret-from-post-devices"
 
 // Menu items
 const char* menuItems[] = {"Burger", "Pizza", "Salad", "Pasta", "Drink"};
@@ -66,10 +70,35 @@ void setup() {
   pinMode(BUTTON_3, INPUT_PULLUP);
   pinMode(BUTTON_4, INPUT_PULLUP);
 
+  // Requests are signed with the current time; the clock is set over NTP once WiFi is up
+  configTime(0, 0, "pool.ntp.org");
+
   // Show welcome screen
   displayWelcomeScreen();
 }
 
+// signRequest returns the hex HMAC-SHA256 of "<timestamp>\n<method>\n<path>\n<body>"
+// under the device secret, as checked by the order service
+String signRequest(long timestamp, const char* method, const char* path, const String& body) {
+  String message = String(timestamp) + "\n" + method + "\n" + path + "\n" + body;
+  unsigned char mac[32];
+
+  mbedtls_md_context_t ctx;
+  mbedtls_md_init(&ctx);
+  mbedtls_md_setup(&ctx, mbedtls_md_info_from_type(MBEDTLS_MD_SHA256), 1);
+  mbedtls_md_hmac_starts(&ctx, (const unsigned char*)DEVICE_SECRET, strlen(DEVICE_SECRET));
+  mbedtls_md_hmac_update(&ctx, (const unsigned char*)message.c_str(), message.length());
+  mbedtls_md_hmac_finish(&ctx, mac);
+  mbedtls_md_free(&ctx);
+
+  String signature = "";
+  for (int i = 0; i < 32; i++) {
+    if (mac[i] < 0x10) signature += "0";
+    signature += String(mac[i], HEX);
+  }
+  return signature;
+}
+
 void displayWelcomeScreen() {
   display.clearDisplay();
   display.setTextSize(2);
@@ -194,13 +223,8 @@ void submitOrder() {
   display.println("Order Sent!");
   display.display();
   
-  // Simulate POST request
-  Serial.println("POST http://localhost:8000/orders");
-  Serial.println("Content-Type: application/json");
-  Serial.println();
-  
   // Construct JSON payload
-  String json = "{\n  \"TableNumber\": " + String(TABLE_NUMBER) + ",\n  \"Items\": [";
+  String json = "{\n  \"Items\": [";
   for (int i = 0; i < cartSize; i++) {
     // Find ItemID (1-based index of menu item)
     int itemID = 0;
@@ -219,6 +243,15 @@ void submitOrder() {
     if (i < cartSize - 1) json += ",";
   }
   json += "\n  ]\n}";
+
+  // Simulate a signed POST request
+  long timestamp = time(nullptr);
+  Serial.println("POST http://localhost:8000/orders");
+  Serial.println("Content-Type: application/json");
+  Serial.println("X-Device-ID: " DEVICE_ID);
+  Serial.println("X-Device-Timestamp: " + String(timestamp));
+  Serial.println("X-Device-Signature: " + signRequest(timestamp, "POST", "/orders", json));
+  Serial.println();
   Serial.println(json);
 
   // Reset cart
@@ -1,13 +1,24 @@
-import React from 'react';
-import { Routes, Route, NavLink } from 'react-router-dom';
+import React, { useState } from 'react';
+import { Routes, Route, NavLink, Navigate } from 'react-router-dom';
 import Dashboard from './pages/Dashboard';
 import Orders from './pages/Orders';
 import Kitchen from './pages/Kitchen';
+import Login from './pages/Login';
+import { getSession, logout, canOpen, PAGE_ROLES } from './auth';
 import { WebSocketProvider } from './WebSocketContext';
 import { ToastContainer } from 'react-toastify';
 import 'react-toastify/dist/ReactToastify.css';
 
 function App() {
+  const [session, setSession] = useState(getSession);
+
+  if (!session) {
+    return <Login onLogin={setSession} />;
+  }
+
+  // Staff land on the first page their role may open
+  const home = Object.keys(PAGE_ROLES).find(path => canOpen(session, path)) ?? '/';
+
   return (
     <WebSocketProvider>
       <div className="container-fluid">
@@ -17,37 +28,47 @@ function App() {
             <div className="d-flex flex-column p-3">
               <h2 className="mb-4 text-center">Bistro 92</h2>
               <ul className="nav nav-pills flex-column mb-auto">
-                <li className="nav-item mb-2">
-                  <NavLink to="/" className={({ isActive }) => 
-                    isActive ? "nav-link active" : "nav-link"
-                  }>
-                    Dashboard
-                  </NavLink>
-                </li>
-                <li className="nav-item mb-2">
-                  <NavLink to="/orders" className={({ isActive }) => 
-                    isActive ? "nav-link active" : "nav-link"
-                  }>
-                    Orders
-                  </NavLink>
-                </li>
-                <li className="nav-item mb-2">
-                  <NavLink to="/kitchen" className={({ isActive }) => 
-                    isActive ? "nav-link active" : "nav-link"
-                  }>
-                    Kitchen Monitor
-                  </NavLink>
-                </li>
+                {canOpen(session, '/') && (
+                  <li className="nav-item mb-2">
+                    <NavLink to="/" className={({ isActive }) => 
+                      isActive ? "nav-link active" : "nav-link"
+                    }>
+                      Dashboard
+                    </NavLink>
+                  </li>
+                )}
+                {canOpen(session, '/orders') && (
+                  <li className="nav-item mb-2">
+                    <NavLink to="/orders" className={({ isActive }) => 
+                      isActive ? "nav-link active" : "nav-link"
+                    }>
+                      Orders
+                    </NavLink>
+                  </li>
+                )}
+                {canOpen(session, '/kitchen') && (
+                  <li className="nav-item mb-2">
+                    <NavLink to="/kitchen" className={({ isActive }) => 
+                      isActive ? "nav-link active" : "nav-link"
+                    }>
+                      Kitchen Monitor
+                    </NavLink>
+                  </li>
+                )}
               </ul>
+              <div className="mt-4 text-center">
+                <div className="small mb-2">{session.staff.name} ({session.staff.role})</div>
+                <button className="btn btn-outline-light btn-sm" onClick={logout}>Log out</button>
+              </div>
             </div>
           </div>
 
           {/* Main Content */}
           <div className="col-md-10 main-content">
             <Routes>
-              <Route path="/" element={<Dashboard />} />
-              <Route path="/orders" element={<Orders />} />
-              <Route path="/kitchen" element={<Kitchen />} />
+              <Route path="/" element={canOpen(session, '/') ? <Dashboard /> : <Navigate to={home} />} />
+              <Route path="/orders" element={canOpen(session, '/orders') ? <Orders /> : <Navigate to={home} />} />
+              <Route path="/kitchen" element={canOpen(session, '/kitchen') ? <Kitchen /> : <Navigate to={home} />} />
             </Routes>
           </div>
         </div>
@@ -1,5 +1,6 @@
 import React, { createContext, useContext, useEffect, useState, useRef } from 'react';
 import { toast } from 'react-toastify';
+import { getSession } from './auth';
 
 // Create WebSocket context
 const WebSocketContext = createContext();
@@ -64,7 +65,8 @@ export const WebSocketProvider = ({ children }) => {
       }
       
       console.log('Connecting to WebSocket...');
-      const ws = new WebSocket(SOCKET_URL);
+      // Browsers cannot send headers with WebSockets, so the token goes in the URL
+      const ws = new WebSocket(`${SOCKET_URL}&token=${encodeURIComponent(getSession()?.token ?? '')}`);
       socketRef.current = ws;
       
       ws.onopen = () => {
@@ -117,6 +119,17 @@ export const WebSocketProvider = ({ children }) => {
             return updatedNotifications;
           });
           
+          // Cancellations must not be missed, so they stay until dismissed
+          if (notification.type === 'order_cancelled') {
+            toast.error(notification.message, {
+              position: "top-center",
+              autoClose: false,
+              closeOnClick: true,
+              draggable: true,
+              toastId: notification.id,
+            });
+          }
+
           // Show toast notification for new orders only
           if (notification.type === 'new_order') {
             toast.info(`New order from Table ${notification.table_number}`, {
@@ -0,0 +1,57 @@
+import axios from 'axios';
+
+// Key for storing the session (token, expiry and staff account) in localStorage
+const SESSION_STORAGE_KEY = 'bistro92_session';
+
+// Pages each role may open; admins may open all of them
+export const PAGE_ROLES = {
+  '/': ['manager'],
+  '/orders': ['server', 'manager'],
+  '/kitchen': ['chef', 'manager'],
+};
+
+// Returns the stored session, or null when there is none or it has expired
+export const getSession = () => {
+  try {
+    const session = JSON.parse(localStorage.getItem(SESSION_STORAGE_KEY));
+    if (!session || new Date(session.expires_at) <= new Date()) {
+      return null;
+    }
+    return session;
+  } catch (error) {
+    return null;
+  }
+};
+
+export const login = async (username, password) => {
+  const response = await axios.post('http://localhost:8000/auth/login', { username, password });
+  localStorage.setItem(SESSION_STORAGE_KEY, JSON.stringify(response.data));
+  return response.data;
+};
+
+export const logout = () => {
+  localStorage.removeItem(SESSION_STORAGE_KEY);
+  window.location.assign('/');
+};
+
+export const canOpen = (session, path) =>
+  session?.staff?.role === 'admin' || (PAGE_ROLES[path] ?? []).includes(session?.staff?.role);
+
+// Send the token with every request, and go back to the login page once it is rejected
+axios.interceptors.request.use((config) => {
+  const session = getSession();
+  if (session) {
+    config.headers.Authorization = `Bearer ${session.token}`;
+  }
+  return config;
+});
+
+axios.interceptors.response.use(
+  (response) => response,
+  (error) => {
+    if (error.response?.status === 401 && getSession()) {
+      logout();
+    }
+    return Promise.reject(error);
+  }
+);
@@ -1,5 +1,6 @@
 import React, { useMemo, useState } from 'react';
 import { useWebSocket } from '../WebSocketContext';
+import { formatMoney, toMajorUnits } from '../money';
 
 const OrderNotifications = ({ maxHeight = '500px' }) => {
   const { connected, notifications, clearNotifications } = useWebSocket();
@@ -102,6 +103,9 @@ const OrderNotifications = ({ maxHeight = '500px' }) => {
                     Table {notification.table_number}
                     {notification.status && ` - ${notification.status}`}
                   </p>
+                  {notification.assigned_to && (
+                    <small className="d-block">Chef: {notification.assigned_to}</small>
+                  )}
                 </div>
                 <small className={`${selectedNotification?.id === notification.id ? 'text-white' : 'text-muted'}`}>
                   {new Date(notification.timestamp).toLocaleTimeString()}
@@ -159,16 +163,16 @@ const OrderNotifications = ({ maxHeight = '500px' }) => {
                     <li key={index} className="list-group-item d-flex justify-content-between">
                       <span>{item.Name}</span>
                       <span>
-                        {item.Quantity} × ${parseFloat(item.Price).toFixed(2)}
+                        {item.Quantity} × {formatMoney(item.Price)}
                       </span>
                     </li>
                   ))}
                 </ul>
                 
                 <div className="mt-3 text-end">
-                  <strong>Total: ${selectedNotification.items.reduce(
-                    (total, item) => total + (item.Price * item.Quantity), 0
-                  ).toFixed(2)}</strong>
+                  <strong>Total: {formatMoney(selectedNotification.items.reduce(
+                    (total, item) => total + (toMajorUnits(item.Price) * item.Quantity), 0
+                  ))}</strong>
                 </div>
               </>
             )}
@@ -0,0 +1,10 @@
+// Amounts from the API are { amount, currency } in minor units (cents).
+// Plain numbers are still accepted for older data.
+export const toMajorUnits = (value) => {
+  if (value && typeof value === 'object') {
+    return value.amount / 100;
+  }
+  return parseFloat(value) || 0;
+};
+
+export const formatMoney = (value) => `$${toMajorUnits(value).toFixed(2)}`;
@@ -1,5 +1,6 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import axios from 'axios';
+import { formatMoney } from '../money';
 import { Chart as ChartJS, CategoryScale, LinearScale, BarElement, Title, Tooltip, Legend, ArcElement } from 'chart.js';
 import { Bar, Pie } from 'react-chartjs-2';
 import OrderNotifications from '../components/OrderNotifications';
@@ -13,7 +14,8 @@ function Dashboard() {
     pending_orders: 0, 
     total_sales: 0,
     order_stats: { completed: 0, pending: 0, canceled: 0 },
-    popular_items: []
+    popular_items: [],
+    staff: []
   });
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
@@ -122,7 +124,7 @@ function Dashboard() {
               <div className="card">
                 <div className="card-body">
                   <h5 className="card-title">Total Sales</h5>
-                  <h2 className="display-4 text-success">${metrics.total_sales.toFixed(2)}</h2>
+                  <h2 className="display-4 text-success">{formatMoney(metrics.total_sales)}</h2>
                 </div>
               </div>
             </div>
@@ -177,6 +179,39 @@ function Dashboard() {
           </div>
         </div>
       </div>
+      <div className="row">
+        <div className="col-12 mb-4">
+          <div className="card">
+            <div className="card-body">
+              <h5 className="card-title">Chef Workload</h5>
+              {metrics.staff && metrics.staff.length > 0 ? (
+                <table className="table table-sm mb-0">
+                  <thead>
+                    <tr>
+                      <th>Chef</th>
+                      <th>Station</th>
+                      <th>Open Orders</th>
+                      <th>Completed Orders</th>
+                    </tr>
+                  </thead>
+                  <tbody>
+                    {metrics.staff.map(chef => (
+                      <tr key={chef.id}>
+                        <td>{chef.name}</td>
+                        <td>{chef.station || 'Any'}</td>
+                        <td>{chef.open_orders}</td>
+                        <td>{chef.completed_orders}</td>
+                      </tr>
+                    ))}
+                  </tbody>
+                </table>
+              ) : (
+                <p className="text-muted mb-0">No chefs on record</p>
+              )}
+            </div>
+          </div>
+        </div>
+      </div>
     </div>
   );
 }
@@ -8,10 +8,37 @@ const ORDER_STATUS = {
   PENDING: 'Pending',
   IN_PROGRESS: 'In Progress',
   READY: 'Ready',
+  READY_FOR_PICKUP: 'Ready for Pickup',
+  OUT_FOR_DELIVERY: 'Out for Delivery',
   COMPLETED: 'Completed',
   CANCELLED: 'Cancelled'
 };
 
+// The statuses orders of each type go through, one step at a time; the backend only
+// accepts a move to the next one (store.statusFlows)
+const STATUS_FLOWS = {
+  'dine-in': [ORDER_STATUS.PENDING, ORDER_STATUS.IN_PROGRESS, ORDER_STATUS.READY, ORDER_STATUS.COMPLETED],
+  takeaway: [ORDER_STATUS.PENDING, ORDER_STATUS.IN_PROGRESS, ORDER_STATUS.READY_FOR_PICKUP, ORDER_STATUS.COMPLETED],
+  delivery: [ORDER_STATUS.PENDING, ORDER_STATUS.IN_PROGRESS, ORDER_STATUS.READY, ORDER_STATUS.OUT_FOR_DELIVERY, ORDER_STATUS.COMPLETED],
+};
+
+// The button that moves an order on to each status
+const STATUS_ACTIONS = {
+  [ORDER_STATUS.IN_PROGRESS]: { label: 'Start Preparation', className: 'btn-primary' },
+  [ORDER_STATUS.READY]: { label: 'Mark as Ready', className: 'btn-success' },
+  [ORDER_STATUS.READY_FOR_PICKUP]: { label: 'Ready for Pickup', className: 'btn-success' },
+  [ORDER_STATUS.OUT_FOR_DELIVERY]: { label: 'Out for Delivery', className: 'btn-info' },
+  [ORDER_STATUS.COMPLETED]: { label: 'Complete Order', className: 'btn-secondary' },
+};
+
+// nextStatus returns the status that follows the order's one in the flow of its type,
+// or undefined when there is none
+const nextStatus = (order) => {
+  const flow = STATUS_FLOWS[order.type || 'dine-in'] || [];
+  const index = flow.indexOf(order.status);
+  return index >= 0 ? flow[index + 1] : undefined;
+};
+
 function Kitchen() {
   const [orders, setOrders] = useState([]);
   const [selectedTable, setSelectedTable] = useState('all');
@@ -35,23 +62,30 @@ function Kitchen() {
   const fetchOrders = async () => {
     setIsLoading(true);
     try {
-      const response = await axios.get('http://localhost:8000/orders');
-      if (response.data && Array.isArray(response.data)) {
-        // Transform API data to our orders format - updated to match the actual API response format
-        const apiOrders = response.data.map(order => ({
-          id: order.ID,
-          tableNumber: order.TableNumber,
-          items: Array.isArray(order.Items) ? order.Items : [],
-          timestamp: order.OrderTime || new Date().toISOString(),
-          status: order.Status || ORDER_STATUS.PENDING,
-        }));
-        
-        setOrders(apiOrders);
-        
-        // Update tables list
-        const tableNumbers = [...new Set(apiOrders.map(order => order.tableNumber))];
-        setTables(tableNumbers.sort((a, b) => a - b));
-      }
+      // Only the latest of today's orders are shown, so one page is enough however many
+      // the day has had
+      const from = new Date().toISOString().slice(0, 10);
+      const response = await axios.get('http://localhost:8000/orders', {
+        params: { from, limit: 100, sort: '-order_time' },
+      });
+      const fetched = response.data?.orders ?? [];
+
+      // Transform API data to our orders format - updated to match the actual API response format
+      const apiOrders = fetched.map(order => ({
+        id: order.ID,
+        tableNumber: order.TableNumber,
+        items: Array.isArray(order.Items) ? order.Items : [],
+        timestamp: order.OrderTime || new Date().toISOString(),
+        status: order.Status || ORDER_STATUS.PENDING,
+        type: order.Type || 'dine-in',
+        version: order.Version,
+      }));
+      
+      setOrders(apiOrders);
+      
+      // Update tables list
+      const tableNumbers = [...new Set(apiOrders.map(order => order.tableNumber))];
+      setTables(tableNumbers.sort((a, b) => a - b));
     } catch (error) {
       console.error('Error fetching orders:', error);
     } finally {
@@ -71,6 +105,7 @@ function Kitchen() {
 
   // Handle order status change
   const changeOrderStatus = async (orderId, newStatus) => {
+    const current = orders.find(order => order.id === orderId);
     try {
       // Update local state first for immediate feedback
       setOrders(prevOrders => 
@@ -81,22 +116,62 @@ function Kitchen() {
         )
       );
       
-      // Update in the API
-      await axios.patch(`http://localhost:8000/orders/${orderId}`, {
+      // Update in the API; If-Match makes the change fail if someone else changed the order
+      // first, so an order whose version is not known yet is fetched for it
+      let version = current?.version;
+      if (!version) {
+        const { data } = await axios.get(`http://localhost:8000/orders/${orderId}`);
+        version = data.Version;
+      }
+      const response = await axios.patch(`http://localhost:8000/orders/${orderId}`, {
         status: newStatus
+      }, {
+        headers: { 'If-Match': `"${version}"` },
       });
-      
-      // No need to update state again - already updated above
-      // If the API call fails, we'll show an error but the UI won't flicker
+
+      setOrders(prevOrders =>
+        prevOrders.map(order =>
+          order.id === orderId ? { ...order, version: response.data.Version } : order
+        )
+      );
     } catch (error) {
       console.error('Error updating order status:', error);
-      alert('Failed to update order status. Please try again.');
+      if (error.response?.status === 412) {
+        alert(`Order #${orderId} was changed by someone else and is now ${error.response.data.Status}.`);
+      } else {
+        alert('Failed to update order status. Please try again.');
+      }
       
       // Revert the local state change since the API call failed
       fetchOrders();
     }
   };
 
+  // Cancel an order; the backend restores stock, voids payments and frees the table
+  const cancelOrder = async (order) => {
+    const reason = window.prompt(`Why is order #${order.id} being cancelled?`);
+    if (!reason) {
+      return;
+    }
+
+    // The kitchen has already started on it, so double check
+    const started = order.status !== ORDER_STATUS.PENDING;
+    if (started && !window.confirm(`The kitchen has started order #${order.id}. Cancel it anyway?`)) {
+      return;
+    }
+
+    try {
+      await axios.post(`http://localhost:8000/orders/${order.id}/cancel`, {
+        reason,
+        confirm: started
+      });
+      fetchOrders();
+    } catch (error) {
+      console.error('Error cancelling order:', error);
+      alert(error.response?.data?.error?.message || 'Failed to cancel order. Please try again.');
+    }
+  };
+
   // Filtered orders based on selected table
   const filteredOrders = selectedTable === 'all' 
     ? orders 
@@ -108,8 +183,10 @@ function Kitchen() {
       [ORDER_STATUS.PENDING]: 0,
       [ORDER_STATUS.IN_PROGRESS]: 1,
       [ORDER_STATUS.READY]: 2,
-      [ORDER_STATUS.COMPLETED]: 3,
-      [ORDER_STATUS.CANCELLED]: 4
+      [ORDER_STATUS.READY_FOR_PICKUP]: 2,
+      [ORDER_STATUS.OUT_FOR_DELIVERY]: 3,
+      [ORDER_STATUS.COMPLETED]: 4,
+      [ORDER_STATUS.CANCELLED]: 5
     };
     
     const orderA = statusOrder[a.status] !== undefined ? statusOrder[a.status] : 999;
@@ -128,6 +205,8 @@ function Kitchen() {
       [ORDER_STATUS.PENDING]: 'bg-warning',
       [ORDER_STATUS.IN_PROGRESS]: 'bg-primary',
       [ORDER_STATUS.READY]: 'bg-success',
+      [ORDER_STATUS.READY_FOR_PICKUP]: 'bg-success',
+      [ORDER_STATUS.OUT_FOR_DELIVERY]: 'bg-info',
       [ORDER_STATUS.COMPLETED]: 'bg-secondary',
       [ORDER_STATUS.CANCELLED]: 'bg-danger'
     };
@@ -242,37 +321,19 @@ function Kitchen() {
                           </ul>
                           
                           <div className="d-flex flex-wrap justify-content-between">
-                            {order.status === ORDER_STATUS.PENDING && (
-                              <button 
-                                className="btn btn-primary btn-sm mb-2"
-                                onClick={() => changeOrderStatus(order.id, ORDER_STATUS.IN_PROGRESS)}
-                              >
-                                Start Preparation
-                              </button>
-                            )}
-                            
-                            {order.status === ORDER_STATUS.IN_PROGRESS && (
-                              <button 
-                                className="btn btn-success btn-sm mb-2"
-                                onClick={() => changeOrderStatus(order.id, ORDER_STATUS.READY)}
-                              >
-                                Mark as Ready
-                              </button>
-                            )}
-                            
-                            {order.status === ORDER_STATUS.READY && (
+                            {nextStatus(order) && STATUS_ACTIONS[nextStatus(order)] && (
                               <button 
-                                className="btn btn-secondary btn-sm mb-2"
-                                onClick={() => changeOrderStatus(order.id, ORDER_STATUS.COMPLETED)}
+                                className={`btn ${STATUS_ACTIONS[nextStatus(order)].className} btn-sm mb-2`}
+                                onClick={() => changeOrderStatus(order.id, nextStatus(order))}
                               >
-                                Complete Order
+                                {STATUS_ACTIONS[nextStatus(order)].label}
                               </button>
                             )}
                             
                             {(order.status === ORDER_STATUS.PENDING || order.status === ORDER_STATUS.IN_PROGRESS) && (
                               <button 
                                 className="btn btn-danger btn-sm mb-2"
-                                onClick={() => changeOrderStatus(order.id, ORDER_STATUS.CANCELLED)}
+                                onClick={() => cancelOrder(order)}
                               >
                                 Cancel Order
                               </button>
@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import axios from 'axios';
+import { formatMoney, toMajorUnits } from '../money';
 import OrderNotifications from '../components/OrderNotifications';
 import { useWebSocket } from '../WebSocketContext';
 
@@ -72,7 +73,7 @@ function Orders() {
         { 
           ItemID: item.id,
           Name: item.name, 
-          Price: parseFloat(item.price), 
+          Price: toMajorUnits(item.price), 
           Quantity: 1 
         }
       ]);
@@ -185,7 +186,7 @@ function Orders() {
                         <div className="card-body">
                           <h5 className="card-title">{item.name}</h5>
                           <p className="card-text text-muted">{item.category}</p>
-                          <p className="card-text text-primary fw-bold">${parseFloat(item.price).toFixed(2)}</p>
+                          <p className="card-text text-primary fw-bold">{formatMoney(item.price)}</p>
                           <button 
                             className="btn btn-outline-primary w-100"
                             onClick={() => handleAddItem(item)}